@@ -0,0 +1,375 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// emptyJSON is the content of the config blob of artifacts.
+var emptyJSON = []byte("{}")
+
+// artifact is a minimal OCI artifact manifest holding a single blob, implementing partial.CompressedImageCore.
+type artifact struct {
+	manifest []byte
+	blob     v1.Layer
+}
+
+// RawConfigFile implements partial.ImageCore.
+func (a *artifact) RawConfigFile() ([]byte, error) {
+	return emptyJSON, nil
+}
+
+// MediaType implements partial.ImageCore.
+func (a *artifact) MediaType() (types.MediaType, error) {
+	return types.OCIManifestSchema1, nil
+}
+
+// RawManifest implements partial.CompressedImageCore.
+func (a *artifact) RawManifest() ([]byte, error) {
+	return a.manifest, nil
+}
+
+// LayerByDigest implements partial.CompressedImageCore.
+func (a *artifact) LayerByDigest(h v1.Hash) (partial.CompressedLayer, error) {
+	digest, err := a.blob.Digest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute blob digest: %w", err)
+	}
+
+	if h != digest {
+		return nil, fmt.Errorf("failed to find blob %s in artifact: %w", h, errArtifactNoBlob)
+	}
+
+	return a.blob, nil
+}
+
+// PushArtifact pushes the given data as an OCI artifact attached to the image subjectRef, and returns
+// the digest reference of the pushed artifact manifest. The artifact can then be discovered through
+// the referrers API of the subject.
+//
+// The artifact type is used as the media type of both the manifest config and the data blob.
+// The "org.opencontainers.image.created" annotation is set to the current time if not given.
+func (r *Registry) PushArtifact(
+	subjectRef string, artifactType string, data []byte, annotations map[string]string,
+) (string, error) {
+	ref, err := r.parseReference(subjectRef)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse image reference %s: %w", subjectRef, err)
+	}
+
+	var subject *v1.Descriptor
+
+	err = r.withAuthRefresh(func() error {
+		subject, err = remote.Head(ref, r.remoteOptions()...)
+
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get head from remote for image %s: %w", subjectRef, err)
+	}
+
+	img, err := r.newArtifact(*subject, types.MediaType(artifactType), data, annotations)
+	if err != nil {
+		return "", fmt.Errorf("failed to create artifact for image %s: %w", subjectRef, err)
+	}
+
+	digest, err := img.Digest()
+	if err != nil {
+		return "", fmt.Errorf("failed to compute artifact digest for image %s: %w", subjectRef, err)
+	}
+
+	dst := ref.Context().Digest(digest.String())
+
+	err = r.withAuthRefresh(func() error {
+		return remote.Write(dst, img, r.remoteOptions(withWrite())...)
+	})
+	if err == nil {
+		err = r.verifyWrite(dst, digest)
+	}
+
+	r.emit("PushArtifact", dst.String(), digest, err)
+
+	if err != nil {
+		return "", fmt.Errorf("failed to push artifact for image %s: %w", subjectRef, err)
+	}
+
+	return dst.String(), nil
+}
+
+// newArtifact builds an OCI artifact holding data and referring to subject.
+func (r *Registry) newArtifact(
+	subject v1.Descriptor, artifactType types.MediaType, data []byte, annotations map[string]string,
+) (v1.Image, error) {
+	blob := static.NewLayer(data, artifactType)
+
+	blobDesc, err := partial.Descriptor(blob)
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe blob: %w", err)
+	}
+
+	configDigest, configSize, err := v1.SHA256(bytes.NewReader(emptyJSON))
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute config digest: %w", err)
+	}
+
+	manifestAnnotations := map[string]string{annotationCreated: r.clock.Now().UTC().Format(time.RFC3339)}
+	for key, value := range annotations {
+		manifestAnnotations[key] = value
+	}
+
+	manifest, err := json.Marshal(v1.Manifest{
+		SchemaVersion: 2, //nolint:mnd
+		MediaType:     types.OCIManifestSchema1,
+		Config: v1.Descriptor{
+			MediaType: artifactType,
+			Size:      configSize,
+			Digest:    configDigest,
+		},
+		Layers:      []v1.Descriptor{*blobDesc},
+		Annotations: manifestAnnotations,
+		Subject: &v1.Descriptor{
+			MediaType: subject.MediaType,
+			Size:      subject.Size,
+			Digest:    subject.Digest,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+
+	img, err := partial.CompressedToImage(&artifact{manifest: manifest, blob: blob})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create image: %w", err)
+	}
+
+	return img, nil
+}
+
+// Subject returns the subject descriptor declared by the manifest of the given image, artifact
+// or index, which is the manifest it is attached to. It returns nil if the manifest has no subject.
+func (r *Registry) Subject(imageRef string) (*v1.Descriptor, error) {
+	ref, err := r.parseReference(imageRef)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse image reference %s: %w", imageRef, err)
+	}
+
+	var desc *remote.Descriptor
+
+	err = r.withAuthRefresh(func() error {
+		desc, err = remote.Get(ref, r.remoteOptions()...)
+
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get manifest from remote for image %s: %w", imageRef, err)
+	}
+
+	// Image manifests and indexes both declare their subject the same way.
+	var manifest struct {
+		Subject *v1.Descriptor `json:"subject,omitempty"`
+	}
+
+	err = json.Unmarshal(desc.Manifest, &manifest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse manifest for image %s: %w", imageRef, err)
+	}
+
+	return manifest.Subject, nil
+}
+
+// ArtifactBlob is a blob of an artifact, as returned by FetchArtifactBlobs.
+type ArtifactBlob struct {
+	// MediaType is the media type of the blob, as declared by the artifact manifest.
+	MediaType types.MediaType
+	// Data is the content of the blob.
+	Data []byte
+}
+
+// FetchArtifact downloads the artifact of the given digest from the repository, like the ones
+// discovered through the referrers API or pushed with PushArtifact, and returns the content and
+// media type of its first blob. Use FetchArtifactBlobs for artifacts made of several blobs.
+func (r *Registry) FetchArtifact(repository, digest string) ([]byte, types.MediaType, error) {
+	blobs, err := r.FetchArtifactBlobs(repository, digest)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(blobs) == 0 {
+		return nil, "", fmt.Errorf("failed to read artifact %s in repository %s: %w", digest, repository, errArtifactNoBlob)
+	}
+
+	return blobs[0].Data, blobs[0].MediaType, nil
+}
+
+// FetchArtifactBlobs downloads the artifact of the given digest from the repository, and returns
+// all its blobs in the order of its manifest.
+func (r *Registry) FetchArtifactBlobs(repository, digest string) ([]ArtifactBlob, error) {
+	repo, err := r.newRepository(repository)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse repository %s: %w", repository, err)
+	}
+
+	digest, err = NormalizeDigest(digest)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := v1.NewHash(digest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse digest %s: %w", digest, err)
+	}
+
+	ref := repo.Digest(hash.String())
+
+	var blobs []ArtifactBlob
+
+	err = r.withAuthRefresh(func() error {
+		blobs, err = r.readArtifactBlobs(ref)
+
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download artifact %s: %w", ref, err)
+	}
+
+	return blobs, nil
+}
+
+// readArtifactBlobs returns the blobs of the given artifact manifest.
+func (r *Registry) readArtifactBlobs(ref name.Digest) ([]ArtifactBlob, error) {
+	artifact, err := remote.Image(ref, r.remoteOptions()...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get artifact %s: %w", ref, err)
+	}
+
+	manifest, err := artifact.Manifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get artifact %s manifest: %w", ref, err)
+	}
+
+	blobs := make([]ArtifactBlob, 0, len(manifest.Layers))
+
+	for _, desc := range manifest.Layers {
+		layer, err := artifact.LayerByDigest(desc.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get artifact %s blob %s: %w", ref, desc.Digest, err)
+		}
+
+		data, err := readLayer(layer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read artifact %s blob %s: %w", ref, desc.Digest, err)
+		}
+
+		blobs = append(blobs, ArtifactBlob{MediaType: desc.MediaType, Data: data})
+	}
+
+	return blobs, nil
+}
+
+// readLayer returns the compressed content of the given layer.
+func readLayer(layer v1.Layer) ([]byte, error) {
+	rc, err := layer.Compressed()
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	defer rc.Close()
+
+	return io.ReadAll(rc) //nolint:wrapcheck
+}
+
+// CopyArtifact copies the artifact (or image, or index) of srcRef to dstRef as is: its manifests
+// are put byte for byte and its blobs are copied whatever their media type, so the digest, the
+// artifact type and the subject of the artifact are preserved, unlike with Copy which handles
+// image content only. Non-distributable blobs are not copied.
+func (r *Registry) CopyArtifact(srcRef, dstRef string) error {
+	src, err := r.parseReference(srcRef)
+	if err != nil {
+		return fmt.Errorf("failed to parse image reference %s: %w", srcRef, err)
+	}
+
+	dst, err := r.parseDestination(dstRef)
+	if err != nil {
+		return fmt.Errorf("failed to parse image reference %s: %w", dstRef, err)
+	}
+
+	var digest v1.Hash
+
+	err = r.withAuthRefresh(func() error {
+		digest, err = r.copyManifest(src, dst)
+
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to copy artifact %s to %s: %w", srcRef, dstRef, err)
+	}
+
+	return r.verifyWrite(dst, digest)
+}
+
+// copyManifest copies the manifest of src to dst as is, after the manifests it references (for an
+// index) and its blobs, and returns its digest.
+func (r *Registry) copyManifest(src, dst name.Reference) (v1.Hash, error) {
+	desc, err := remote.Get(src, r.remoteOptions()...)
+	if err != nil {
+		return v1.Hash{}, fmt.Errorf("failed to get manifest %s: %w", src, err)
+	}
+
+	// Image manifests, artifact manifests and indexes all reference their content this way.
+	var manifest struct {
+		Config    *v1.Descriptor  `json:"config,omitempty"`
+		Layers    []v1.Descriptor `json:"layers,omitempty"`
+		Blobs     []v1.Descriptor `json:"blobs,omitempty"`
+		Manifests []v1.Descriptor `json:"manifests,omitempty"`
+	}
+
+	err = json.Unmarshal(desc.Manifest, &manifest)
+	if err != nil {
+		return v1.Hash{}, fmt.Errorf("failed to parse manifest %s: %w", src, err)
+	}
+
+	for _, child := range manifest.Manifests {
+		_, err = r.copyManifest(src.Context().Digest(child.Digest.String()), dst.Context().Digest(child.Digest.String()))
+		if err != nil {
+			return v1.Hash{}, err
+		}
+	}
+
+	blobs := slices.Concat(manifest.Layers, manifest.Blobs)
+	if manifest.Config != nil {
+		blobs = append(blobs, *manifest.Config)
+	}
+
+	for _, blob := range blobs {
+		if !blob.MediaType.IsDistributable() {
+			continue
+		}
+
+		layer, err := remote.Layer(src.Context().Digest(blob.Digest.String()), r.remoteOptions(withLayerStreaming())...)
+		if err != nil {
+			return v1.Hash{}, fmt.Errorf("failed to get blob %s: %w", blob.Digest, err)
+		}
+
+		err = remote.WriteLayer(dst.Context(), layer, r.remoteOptions(withLayerStreaming(), withWrite())...)
+		if err != nil {
+			return v1.Hash{}, fmt.Errorf("failed to write blob %s: %w", blob.Digest, err)
+		}
+	}
+
+	err = remote.Put(dst, desc, r.remoteOptions(withWrite())...)
+	if err != nil {
+		return v1.Hash{}, fmt.Errorf("failed to put manifest %s: %w", dst, err)
+	}
+
+	return desc.Digest, nil
+}
@@ -0,0 +1,94 @@
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// ErrInvalidAttestation is returned by VerifySubject when the attestation has no subject.
+var ErrInvalidAttestation = errors.New("invalid in-toto attestation")
+
+// inTotoStatement is the part of an in-toto statement holding its subjects.
+type inTotoStatement struct {
+	Subject []struct {
+		Name   string            `json:"name"`
+		Digest map[string]string `json:"digest"`
+	} `json:"subject"`
+}
+
+// dsseEnvelope is a DSSE envelope, in which in-toto statements are usually signed.
+// The payload is base64-encoded in JSON, and decoded into a byte slice.
+type dsseEnvelope struct {
+	PayloadType string `json:"payloadType"`
+	Payload     []byte `json:"payload"`
+}
+
+// VerifySubject reports whether one of the subjects of the given in-toto attestation, a statement
+// or a DSSE envelope holding one, has the digest the given image resolves to, i.e. whether the
+// attestation refers to this image. For an index it is the digest of the index itself, not the
+// ones of its images. The signature of the envelope is not verified.
+// It fails with ErrInvalidAttestation if the statement has no subject.
+func (r *Registry) VerifySubject(imageRef string, attestation []byte) (bool, error) {
+	statement, err := parseStatement(attestation)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse attestation: %w", err)
+	}
+
+	ref, err := r.parseReference(imageRef)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse image reference %s: %w", imageRef, err)
+	}
+
+	var head *v1.Descriptor
+
+	err = r.withAuthRefresh(func() error {
+		head, err = remote.Head(ref, r.remoteOptions()...)
+
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to get head from remote for image %s: %w", imageRef, err)
+	}
+
+	for _, subject := range statement.Subject {
+		for algorithm, hex := range subject.Digest {
+			if strings.EqualFold(algorithm, head.Digest.Algorithm) && strings.EqualFold(hex, head.Digest.Hex) {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// parseStatement parses the given in-toto statement, unwrapping it from its DSSE envelope if any.
+func parseStatement(attestation []byte) (*inTotoStatement, error) {
+	var envelope dsseEnvelope
+
+	err := json.Unmarshal(attestation, &envelope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode envelope: %w", err)
+	}
+
+	if envelope.PayloadType != "" {
+		attestation = envelope.Payload
+	}
+
+	var statement inTotoStatement
+
+	err = json.Unmarshal(attestation, &statement)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode statement: %w", err)
+	}
+
+	if len(statement.Subject) == 0 {
+		return nil, fmt.Errorf("failed to find statement subject: %w", ErrInvalidAttestation)
+	}
+
+	return &statement, nil
+}
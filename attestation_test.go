@@ -0,0 +1,68 @@
+package registry
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func TestParseStatement(t *testing.T) {
+	t.Parallel()
+
+	const statement = `{"_type":"https://in-toto.io/Statement/v1",` +
+		`"subject":[{"name":"app","digest":{"sha256":"abc"}}]}`
+
+	tests := []struct {
+		name        string
+		attestation string
+		wantDigest  string
+		wantErr     error
+	}{
+		{
+			name:        "statement",
+			attestation: statement,
+			wantDigest:  "abc",
+		},
+		{
+			name: "dsse envelope",
+			attestation: `{"payloadType":"application/vnd.in-toto+json","payload":"` +
+				base64.StdEncoding.EncodeToString([]byte(statement)) + `"}`,
+			wantDigest: "abc",
+		},
+		{
+			name:        "no subject",
+			attestation: `{"_type":"https://in-toto.io/Statement/v1","subject":[]}`,
+			wantErr:     ErrInvalidAttestation,
+		},
+		{
+			name: "envelope without subject",
+			attestation: `{"payloadType":"application/vnd.in-toto+json","payload":"` +
+				base64.StdEncoding.EncodeToString([]byte(`{}`)) + `"}`,
+			wantErr: ErrInvalidAttestation,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := parseStatement([]byte(tt.attestation))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("parseStatement() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr != nil {
+				return
+			}
+
+			if digest := got.Subject[0].Digest["sha256"]; digest != tt.wantDigest {
+				t.Errorf("parseStatement() subject digest = %q, want %q", digest, tt.wantDigest)
+			}
+		})
+	}
+
+	_, err := parseStatement([]byte("not json"))
+	if err == nil {
+		t.Error("parseStatement() error = nil, want an error for invalid JSON")
+	}
+}
@@ -0,0 +1,180 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/docker/cli/cli/config/configfile"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+// ErrAnonymousCredentials is returned with WithRequireAuth when no credentials are found for the
+// registry, which would otherwise be accessed anonymously.
+var ErrAnonymousCredentials = errors.New("no credentials found for registry")
+
+// getAuthenticator returns the authenticator currently used by the Registry.
+func (r *Registry) getAuthenticator() authn.Authenticator {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.authenticator
+}
+
+// setAuthenticator replaces the authenticator used by the Registry, and forgets the ones
+// resolved for the other registries along with the shared puller authenticated with them.
+func (r *Registry) setAuthenticator(auth authn.Authenticator) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.authenticator = auth
+	r.hostAuthenticators = nil
+	r.puller = nil
+}
+
+// callAuthenticator returns the authenticator of a call to the target registry: the one set with
+// WithCallAuth, if any, or else the one resolved for the target by targetAuthenticator.
+func (r *Registry) callAuthenticator(co callOptions, target authn.Resource) (authn.Authenticator, error) {
+	if co.auth != nil {
+		return co.auth, nil
+	}
+
+	return r.targetAuthenticator(target)
+}
+
+// targetAuthenticator returns the authenticator of the target registry: the one of the Registry
+// for its own registry, or else the one resolved with the keychain of the Registry, which is
+// cached per registry.
+func (r *Registry) targetAuthenticator(target authn.Resource) (authn.Authenticator, error) {
+	if target.RegistryStr() == r.RegistryStr() {
+		return r.getAuthenticator(), nil
+	}
+
+	r.mu.RLock()
+	auth, ok := r.hostAuthenticators[target.RegistryStr()]
+	r.mu.RUnlock()
+
+	if ok {
+		return auth, nil
+	}
+
+	auth, err := resolveKeychain(r.ctx, r.keychain, target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve authenticator of %s using keychain: %w", target.RegistryStr(), err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.hostAuthenticators == nil {
+		r.hostAuthenticators = make(map[string]authn.Authenticator)
+	}
+
+	r.hostAuthenticators[target.RegistryStr()] = auth
+
+	return auth, nil
+}
+
+// targetKeychain is an authn.Keychain resolving the authenticators with targetAuthenticator.
+type targetKeychain struct {
+	r *Registry
+}
+
+// Resolve implements authn.Keychain.
+func (k targetKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	return k.r.targetAuthenticator(target)
+}
+
+// withAuthRefresh runs the given call, and if it fails because the registry rejected the
+// credentials (e.g. an expired token), resolves the authenticator again and retries the call once.
+// The shared puller is reset after any other failure than a missing manifest or blob.
+func (r *Registry) withAuthRefresh(call func() error) error {
+	err := call()
+	if err != nil && !isNotFound(err) {
+		// The shared puller caches the failures to authenticate to a repository.
+		r.resetPuller()
+	}
+
+	if !isUnauthorized(err) {
+		return err
+	}
+
+	if authErr := r.initAuthenticator(r.ctx); authErr != nil {
+		return fmt.Errorf("failed to refresh authenticator: %w", errors.Join(err, authErr))
+	}
+
+	return call()
+}
+
+// resolveKeychain resolves the authenticator of the target with the given keychain, giving up
+// once ctx is done even if the keychain doesn't support contexts (e.g. a hanging credential helper).
+func resolveKeychain(ctx context.Context, keychain authn.Keychain, target authn.Resource) (authn.Authenticator, error) {
+	type result struct {
+		auth authn.Authenticator
+		err  error
+	}
+
+	done := make(chan result, 1)
+
+	go func() {
+		auth, err := authn.Resolve(ctx, keychain, target)
+		done <- result{auth: auth, err: err}
+	}()
+
+	select {
+	case res := <-done:
+		return res.auth, res.err //nolint:wrapcheck
+	case <-ctx.Done():
+		return nil, fmt.Errorf("failed to resolve credentials of %s: %w", target, ctx.Err())
+	}
+}
+
+// dockerConfigAuthenticator returns the authenticator for the target registry found in the given
+// docker config JSON, and whether the config holds credentials for it.
+func dockerConfigAuthenticator(target authn.Resource, config string) (authn.Authenticator, bool, error) {
+	cf := configfile.New("")
+
+	err := cf.LoadFromReader(strings.NewReader(config))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to parse docker config: %w", err)
+	}
+
+	key := target.RegistryStr()
+	if key == name.DefaultRegistry {
+		key = authn.DefaultAuthKey
+	}
+
+	cfg, ok := cf.AuthConfigs[key]
+	if !ok {
+		return nil, false, nil
+	}
+
+	return authn.FromConfig(authn.AuthConfig{
+		Username:      cfg.Username,
+		Password:      cfg.Password,
+		Auth:          cfg.Auth,
+		IdentityToken: cfg.IdentityToken,
+		RegistryToken: cfg.RegistryToken,
+	}), true, nil
+}
+
+// AuthChallenge sends an unauthenticated request to the /v2/ endpoint of the registry, and returns
+// the token realm, service and scopes advertised by its WWW-Authenticate challenge. They are empty
+// if the registry doesn't require authentication.
+func (r *Registry) AuthChallenge() (string, string, []string, error) {
+	reg, err := r.registry()
+	if err != nil {
+		return "", "", nil, fmt.Errorf("failed to parse registry %s: %w", r.URL, err)
+	}
+
+	challenge, err := transport.Ping(r.ctx, reg, r.transport(callOptions{}))
+	if err != nil {
+		return "", "", nil, fmt.Errorf("failed to ping registry %s: %w", reg, err)
+	}
+
+	return challenge.Parameters["realm"], challenge.Parameters["service"],
+		strings.Fields(challenge.Parameters["scope"]), nil
+}
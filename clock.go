@@ -0,0 +1,40 @@
+package registry
+
+import "time"
+
+// Clock is the source of time used by the time-dependent logic of a Registry.
+type Clock interface {
+	Now() time.Time
+}
+
+// TimerClock is a Clock also providing the timers waited on by a Registry, like the delays between
+// the post-write verification attempts. A Clock not implementing it waits with time.After.
+type TimerClock interface {
+	Clock
+
+	// After returns a channel receiving the current time once the given duration has elapsed.
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock is the default Clock, backed by time.Now.
+type realClock struct{}
+
+// Now returns the current local time.
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// After waits for the given duration with time.After.
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// after returns a channel receiving the current time once the given duration has elapsed on the
+// clock of the Registry.
+func (r *Registry) after(d time.Duration) <-chan time.Time {
+	if clock, ok := r.clock.(TimerClock); ok {
+		return clock.After(d)
+	}
+
+	return time.After(d)
+}
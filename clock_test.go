@@ -0,0 +1,79 @@
+package registry
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a TimerClock whose timers fire immediately, advancing its time by the durations
+// waited, which it records.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	waited []time.Duration
+}
+
+// newFakeClock returns a fakeClock set to a fixed date.
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.waited = append(c.waited, d)
+	c.now = c.now.Add(d)
+
+	fired := make(chan time.Time, 1)
+	fired <- c.now
+
+	return fired
+}
+
+func (c *fakeClock) Waited() []time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.waited
+}
+
+// nowClock is a Clock without timers.
+type nowClock struct{}
+
+func (nowClock) Now() time.Time {
+	return time.Now()
+}
+
+func TestAfter(t *testing.T) {
+	t.Parallel()
+
+	clock := newFakeClock()
+	r := &Registry{clock: clock}
+
+	select {
+	case <-r.after(time.Hour):
+	case <-time.After(time.Second):
+		t.Fatal("after() didn't use the timer of the TimerClock")
+	}
+
+	if got := clock.Waited(); len(got) != 1 || got[0] != time.Hour {
+		t.Errorf("TimerClock.After() calls = %v, want [1h]", got)
+	}
+
+	r = &Registry{clock: nowClock{}}
+
+	select {
+	case <-r.after(time.Millisecond):
+	case <-time.After(time.Second):
+		t.Fatal("after() didn't fall back to time.After for a Clock without timers")
+	}
+}
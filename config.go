@@ -0,0 +1,158 @@
+package registry
+
+import (
+	"fmt"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// ImageDetails holds the manifest digest and the config of an image, fetched once by InspectFull
+// so that several of its properties can be read without more round-trips.
+type ImageDetails struct {
+	// Digest is the digest of the manifest of the image (of the image matching the default
+	// platform for an index).
+	Digest v1.Hash
+	// ConfigFile is the config of the image, as returned by Inspect.
+	ConfigFile *v1.ConfigFile
+}
+
+// ExposedPorts returns the ports exposed by the image, like "8080/tcp".
+func (d *ImageDetails) ExposedPorts() map[string]struct{} {
+	return d.ConfigFile.Config.ExposedPorts
+}
+
+// WorkingDir returns the working directory of the image, empty when unset.
+func (d *ImageDetails) WorkingDir() string {
+	return d.ConfigFile.Config.WorkingDir
+}
+
+// User returns the user the image runs as: a username or uid, optionally followed by a group
+// (like "1000:1000"). It is empty when unset, meaning the container runs as root.
+func (d *ImageDetails) User() string {
+	return d.ConfigFile.Config.User
+}
+
+// InspectFull fetches the manifest digest and the config of the given image. For an index, the
+// image matching the default platform is used.
+func (r *Registry) InspectFull(imageRef string, opts ...CallOption) (*ImageDetails, error) {
+	ref, err := r.parseReference(imageRef)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse image reference %s: %w", imageRef, err)
+	}
+
+	var details ImageDetails
+
+	err = r.withAuthRefresh(func() error {
+		img, err := r.remoteImage(ref, opts...)
+		if err != nil {
+			return err
+		}
+
+		details.Digest, err = img.Digest()
+		if err != nil {
+			return err
+		}
+
+		details.ConfigFile, err = img.ConfigFile()
+
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get image details from remote for image %s: %w", imageRef, err)
+	}
+
+	return &details, nil
+}
+
+// ExposedPorts returns the ports exposed by the given image, like "8080/tcp".
+// Use InspectFull to read several properties of the config with a single fetch.
+func (r *Registry) ExposedPorts(imageRef string) (map[string]struct{}, error) {
+	details, err := r.InspectFull(imageRef)
+	if err != nil {
+		return nil, err
+	}
+
+	return details.ExposedPorts(), nil
+}
+
+// WorkingDir returns the working directory of the given image, empty when unset.
+// Use InspectFull to read several properties of the config with a single fetch.
+func (r *Registry) WorkingDir(imageRef string) (string, error) {
+	details, err := r.InspectFull(imageRef)
+	if err != nil {
+		return "", err
+	}
+
+	return details.WorkingDir(), nil
+}
+
+// RunAsUser returns the user the given image runs as: a username or uid, optionally followed by a
+// group (like "1000:1000"). It is empty, without error, when unset, meaning the container runs as root.
+// Use InspectFull to read several properties of the config with a single fetch.
+func (r *Registry) RunAsUser(imageRef string) (string, error) {
+	details, err := r.InspectFull(imageRef)
+	if err != nil {
+		return "", err
+	}
+
+	return details.User(), nil
+}
+
+// LayerHistoryEntry is a layer of an image, along with the history entry of the config which
+// created it.
+type LayerHistoryEntry struct {
+	// Digest is the digest of the compressed layer.
+	Digest v1.Hash
+	// Size is the size of the compressed layer.
+	Size int64
+	// CreatedBy is the command which created the layer, like "RUN apt-get install -y curl".
+	CreatedBy string
+	// Created is the time the layer was created at.
+	Created time.Time
+	// Comment is the comment of the history entry, if any.
+	Comment string
+}
+
+// LayerHistory returns the layers of the given image in order, each with the history entry which
+// created it: the history entries of empty layers (ENV, LABEL...) are skipped so the others match
+// the layers one by one. The layers without history entry, if the history is incomplete, have an
+// empty CreatedBy. For an index, the image matching the default platform is used.
+func (r *Registry) LayerHistory(imageRef string) ([]LayerHistoryEntry, error) {
+	img, err := r.Image(imageRef)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := img.Manifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get manifest for image %s: %w", imageRef, err)
+	}
+
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get image details for image %s: %w", imageRef, err)
+	}
+
+	history := make([]v1.History, 0, len(cfg.History))
+	for _, entry := range cfg.History {
+		if !entry.EmptyLayer {
+			history = append(history, entry)
+		}
+	}
+
+	entries := make([]LayerHistoryEntry, 0, len(manifest.Layers))
+
+	for i, layer := range manifest.Layers {
+		entry := LayerHistoryEntry{Digest: layer.Digest, Size: layer.Size}
+		if i < len(history) {
+			entry.CreatedBy = history[i].CreatedBy
+			entry.Created = history[i].Created.Time
+			entry.Comment = history[i].Comment
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
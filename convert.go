@@ -0,0 +1,329 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// mediaTypeConversion is the media type family images are converted to during a copy.
+type mediaTypeConversion int
+
+const (
+	noConversion mediaTypeConversion = iota
+	convertToOCI
+	convertToDocker
+)
+
+// dockerToOCI maps docker media types to their OCI equivalent.
+var dockerToOCI = map[types.MediaType]types.MediaType{
+	types.DockerManifestList:      types.OCIImageIndex,
+	types.DockerManifestSchema2:   types.OCIManifestSchema1,
+	types.DockerConfigJSON:        types.OCIConfigJSON,
+	types.DockerLayer:             types.OCILayer,
+	types.DockerUncompressedLayer: types.OCIUncompressedLayer,
+	types.DockerForeignLayer:      types.OCIRestrictedLayer,
+}
+
+// ociToDocker maps OCI media types to their docker equivalent.
+var ociToDocker = map[types.MediaType]types.MediaType{
+	types.OCIImageIndex:        types.DockerManifestList,
+	types.OCIManifestSchema1:   types.DockerManifestSchema2,
+	types.OCIConfigJSON:        types.DockerConfigJSON,
+	types.OCILayer:             types.DockerLayer,
+	types.OCIUncompressedLayer: types.DockerUncompressedLayer,
+	types.OCIRestrictedLayer:   types.DockerForeignLayer,
+}
+
+// convert returns the equivalent of the given media type in the target family.
+// Media types without an equivalent are returned unchanged.
+func (c mediaTypeConversion) convert(mt types.MediaType) types.MediaType {
+	mapping := dockerToOCI
+	if c == convertToDocker {
+		mapping = ociToDocker
+	}
+
+	if converted, ok := mapping[mt]; ok && c != noConversion {
+		return converted
+	}
+
+	return mt
+}
+
+// convertImage rewrites the manifest, config and layer media types of the given image to the
+// target family. Layers are not recompressed, only their descriptors are updated.
+func convertImage(img v1.Image, conversion mediaTypeConversion) (v1.Image, error) {
+	manifest, err := img.Manifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get manifest: %w", err)
+	}
+
+	unchanged := conversion.convert(manifest.MediaType) == manifest.MediaType &&
+		conversion.convert(manifest.Config.MediaType) == manifest.Config.MediaType
+	for _, layer := range manifest.Layers {
+		unchanged = unchanged && conversion.convert(layer.MediaType) == layer.MediaType
+	}
+
+	if unchanged {
+		return img, nil
+	}
+
+	return rebuildImage(img, conversion.convert(manifest.MediaType), conversion.convert(manifest.Config.MediaType),
+		func(layer v1.Layer, desc v1.Descriptor) (mutate.Addendum, error) {
+			return mutate.Addendum{
+				Layer:       layer,
+				MediaType:   conversion.convert(desc.MediaType),
+				URLs:        desc.URLs,
+				Annotations: desc.Annotations,
+			}, nil
+		})
+}
+
+// layerRebuilder returns the addendum replacing the given layer, described by desc, in a rebuilt image.
+type layerRebuilder func(layer v1.Layer, desc v1.Descriptor) (mutate.Addendum, error)
+
+// rebuildImage rebuilds the given image from scratch with the given manifest and config media types,
+// replacing each of its layers with the addendum returned by rebuild. The config file, the
+// annotations, the subject and the artifact type of the image are preserved.
+func rebuildImage(
+	img v1.Image, manifestMediaType, configMediaType types.MediaType, rebuild layerRebuilder,
+) (v1.Image, error) {
+	manifest, err := img.Manifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get manifest: %w", err)
+	}
+
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config: %w", err)
+	}
+
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get layers: %w", err)
+	}
+
+	addenda := make([]mutate.Addendum, 0, len(layers))
+
+	for i, layer := range layers {
+		add, err := rebuild(layer, manifest.Layers[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to rebuild layer %s: %w", manifest.Layers[i].Digest, err)
+		}
+
+		addenda = append(addenda, add)
+	}
+
+	base := mutate.MediaType(empty.Image, manifestMediaType)
+	base = mutate.ConfigMediaType(base, configMediaType)
+
+	rebuilt, err := mutate.Append(base, addenda...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to append layers: %w", err)
+	}
+
+	rebuilt, err = mutate.ConfigFile(rebuilt, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set config: %w", err)
+	}
+
+	if len(manifest.Annotations) > 0 {
+		rebuilt, _ = mutate.Annotations(rebuilt, manifest.Annotations).(v1.Image)
+	}
+
+	if manifest.Subject != nil {
+		rebuilt, _ = mutate.Subject(rebuilt, *manifest.Subject).(v1.Image)
+	}
+
+	return keepArtifactType(img, rebuilt)
+}
+
+// artifactTypedImage is an image whose manifest carries the given artifactType field, which the
+// images built with the mutate package drop as v1.Manifest has no such field.
+type artifactTypedImage struct {
+	v1.Image
+
+	artifactType string
+}
+
+// ArtifactType returns the artifact type of the image, as used in its descriptors.
+func (i artifactTypedImage) ArtifactType() (string, error) {
+	return i.artifactType, nil
+}
+
+// RawManifest returns the manifest of the wrapped image with the artifactType field set.
+func (i artifactTypedImage) RawManifest() ([]byte, error) {
+	raw, err := i.Image.RawManifest()
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	var fields map[string]json.RawMessage
+
+	err = json.Unmarshal(raw, &fields)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+
+	fields["artifactType"], err = json.Marshal(i.artifactType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode artifact type: %w", err)
+	}
+
+	return json.Marshal(fields) //nolint:wrapcheck
+}
+
+// Digest returns the digest of the manifest returned by RawManifest.
+func (i artifactTypedImage) Digest() (v1.Hash, error) {
+	raw, err := i.RawManifest()
+	if err != nil {
+		return v1.Hash{}, err
+	}
+
+	digest, _, err := v1.SHA256(bytes.NewReader(raw))
+
+	return digest, err //nolint:wrapcheck
+}
+
+// Size returns the size of the manifest returned by RawManifest.
+func (i artifactTypedImage) Size() (int64, error) {
+	raw, err := i.RawManifest()
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(len(raw)), nil
+}
+
+// manifestArtifactType returns the artifactType field of the manifest of the given image, if any.
+func manifestArtifactType(img v1.Image) (string, error) {
+	raw, err := img.RawManifest()
+	if err != nil {
+		return "", fmt.Errorf("failed to get manifest: %w", err)
+	}
+
+	var manifest struct {
+		ArtifactType string `json:"artifactType"`
+	}
+
+	err = json.Unmarshal(raw, &manifest)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse manifest: %w", err)
+	}
+
+	return manifest.ArtifactType, nil
+}
+
+// keepArtifactType sets the artifactType field of the manifest of src, if any, on the manifest of
+// rebuilt, an image built from src with the mutate package.
+func keepArtifactType(src, rebuilt v1.Image) (v1.Image, error) {
+	artifactType, err := manifestArtifactType(src)
+	if err != nil {
+		return nil, err
+	}
+
+	if artifactType == "" {
+		return rebuilt, nil
+	}
+
+	return artifactTypedImage{Image: rebuilt, artifactType: artifactType}, nil
+}
+
+// transformIndex rebuilds the given index, setting its media type with indexMediaType and
+// applying transform to each of its child images (recursively for nested indexes). The
+// "vnd.docker.reference.digest" annotations of the attestation manifests are updated to the new
+// digest of the image they reference, so they stay associated with it.
+// The index is returned unchanged if none of its children nor its media type changed.
+func transformIndex(
+	idx v1.ImageIndex,
+	indexMediaType func(types.MediaType) types.MediaType,
+	transform func(v1.Image) (v1.Image, error),
+) (v1.ImageIndex, error) {
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get index manifest: %w", err)
+	}
+
+	changed := indexMediaType(manifest.MediaType) != manifest.MediaType
+	addenda := make([]mutate.IndexAddendum, 0, len(manifest.Manifests))
+	digests := make(map[string]string, len(manifest.Manifests))
+
+	for _, child := range manifest.Manifests {
+		var add mutate.Appendable
+
+		switch {
+		case child.MediaType.IsIndex():
+			childIdx, err := idx.ImageIndex(child.Digest)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get index %s: %w", child.Digest, err)
+			}
+
+			add, err = transformIndex(childIdx, indexMediaType, transform)
+			if err != nil {
+				return nil, fmt.Errorf("failed to transform index %s: %w", child.Digest, err)
+			}
+		default:
+			img, err := idx.Image(child.Digest)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get image %s: %w", child.Digest, err)
+			}
+
+			add, err = transform(img)
+			if err != nil {
+				return nil, fmt.Errorf("failed to transform image %s: %w", child.Digest, err)
+			}
+		}
+
+		digest, err := add.Digest()
+		if err != nil {
+			return nil, fmt.Errorf("failed to compute digest of %s: %w", child.Digest, err)
+		}
+
+		changed = changed || digest != child.Digest
+		digests[child.Digest.String()] = digest.String()
+
+		addenda = append(addenda, mutate.IndexAddendum{
+			Add: add,
+			Descriptor: v1.Descriptor{
+				Platform:     child.Platform,
+				Annotations:  child.Annotations,
+				URLs:         child.URLs,
+				ArtifactType: child.ArtifactType,
+			},
+		})
+	}
+
+	if !changed {
+		return idx, nil
+	}
+
+	for i, add := range addenda {
+		subject, ok := add.Annotations[annotationReferenceDigest]
+		if !ok || digests[subject] == "" || digests[subject] == subject {
+			continue
+		}
+
+		addenda[i].Annotations = maps.Clone(add.Annotations)
+		addenda[i].Annotations[annotationReferenceDigest] = digests[subject]
+	}
+
+	transformed := mutate.AppendManifests(
+		mutate.IndexMediaType(empty.Index, indexMediaType(manifest.MediaType)), addenda...,
+	)
+
+	if len(manifest.Annotations) > 0 {
+		transformed, _ = mutate.Annotations(transformed, manifest.Annotations).(v1.ImageIndex)
+	}
+
+	if manifest.Subject != nil {
+		transformed, _ = mutate.Subject(transformed, *manifest.Subject).(v1.ImageIndex)
+	}
+
+	return transformed, nil
+}
@@ -0,0 +1,579 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"golang.org/x/sync/errgroup"
+)
+
+// CopyOption configures a Copy.
+type CopyOption func(*copyOptions)
+
+// copyOptions holds the configuration of a Copy.
+type copyOptions struct {
+	conversion   mediaTypeConversion
+	recompress   Compression
+	bestEffort   bool
+	retype       bool
+	maxSize      int64
+	report       *CopyReport
+	layerFilters []func(v1.Descriptor) bool
+}
+
+var (
+	// ErrPartialCopy is returned by Copy with WithBestEffortIndex when some images of an index
+	// couldn't be copied.
+	ErrPartialCopy = errors.New("index partially copied")
+	// ErrImageTooLarge is returned by Copy with WithMaxImageSize when the image to copy is larger
+	// than the limit.
+	ErrImageTooLarge = errors.New("image exceeds maximum size")
+	// ErrNoDestinationRegistry is returned by CopyToMany for a Destination without Registry.
+	ErrNoDestinationRegistry = errors.New("destination has no registry")
+)
+
+// WithConvertToOCI rewrites docker media types to their OCI equivalent during a Copy.
+// Layers are not recompressed, but the digest of the copied content changes.
+func WithConvertToOCI() CopyOption {
+	return func(co *copyOptions) {
+		co.conversion = convertToOCI
+	}
+}
+
+// WithConvertToDocker rewrites OCI media types to their docker equivalent during a Copy.
+// Layers are not recompressed, but the digest of the copied content changes.
+func WithConvertToDocker() CopyOption {
+	return func(co *copyOptions) {
+		co.conversion = convertToDocker
+	}
+}
+
+// WithBestEffortIndex makes the Copy of an index push a reduced index holding only the images
+// that were successfully copied when some fail, instead of failing the whole copy. Copy then
+// returns the descriptor of the reduced index along with an ErrPartialCopy error listing the
+// failed platforms. The copy fails if no image could be copied.
+func WithBestEffortIndex() CopyOption {
+	return func(co *copyOptions) {
+		co.bestEffort = true
+	}
+}
+
+// WithPreserveArtifactType sets whether the copy options modifying the content of an image (like
+// WithConvertToOCI) keep the artifactType field of its manifest, which referrers queries rely on.
+// It is preserved by default: WithPreserveArtifactType(false) drops it so that the artifact type
+// is derived again from the config media type, for instance when intentionally re-typing artifacts.
+// The "vnd.docker.reference.type" annotations of the index children are always preserved.
+func WithPreserveArtifactType(preserve bool) CopyOption {
+	return func(co *copyOptions) {
+		co.retype = !preserve
+	}
+}
+
+// WithMaxImageSize makes Copy fail with ErrImageTooLarge, before any blob is uploaded, when the
+// compressed size of the source image (of all its images for an index, see Size) is larger than
+// size bytes.
+func WithMaxImageSize(size int64) CopyOption {
+	return func(co *copyOptions) {
+		co.maxSize = size
+	}
+}
+
+// Copy copies an image or an index from srcRef to dstRef, and returns the descriptor of the pushed content.
+// The digest differs from the source one when the copy options modify the content.
+func (r *Registry) Copy(srcRef, dstRef string, opts ...CopyOption) (*v1.Descriptor, error) {
+	pushed, err := r.copyRef(srcRef, dstRef, opts...)
+	r.emit("Copy", dstRef, descriptorDigest(pushed), err)
+
+	return pushed, err
+}
+
+// copyRef implements Copy.
+func (r *Registry) copyRef(srcRef, dstRef string, opts ...CopyOption) (*v1.Descriptor, error) {
+	var co copyOptions
+	for _, opt := range opts {
+		opt(&co)
+	}
+
+	src, err := r.parseReference(srcRef)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse image reference %s: %w", srcRef, err)
+	}
+
+	dst, err := r.parseDestination(dstRef)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse image reference %s: %w", dstRef, err)
+	}
+
+	var pushed *v1.Descriptor
+
+	err = r.withAuthRefresh(func() error {
+		desc, err := remote.Get(src, r.remoteOptions(withLayerStreaming())...)
+		if err != nil {
+			return fmt.Errorf("failed to get manifest from remote for image %s: %w", srcRef, err)
+		}
+
+		if co.maxSize > 0 {
+			err = checkImageSize(desc, co.maxSize)
+			if err != nil {
+				return err
+			}
+		}
+
+		if co.report != nil {
+			*co.report = CopyReport{SourceDigest: desc.Digest}
+		}
+
+		if desc.MediaType.IsIndex() {
+			pushed, err = r.copyIndex(desc, dst, co)
+		} else {
+			pushed, err = r.copyImage(desc, dst, co)
+		}
+
+		return err
+	})
+
+	partialErr := err
+	if err != nil && (!errors.Is(err, ErrPartialCopy) || pushed == nil) {
+		return nil, fmt.Errorf("failed to copy %s to %s: %w", srcRef, dstRef, err)
+	}
+
+	if co.report != nil {
+		co.report.Digest = pushed.Digest
+	}
+
+	err = r.verifyWrite(dst, pushed.Digest)
+	if err != nil {
+		return nil, err
+	}
+
+	if partialErr != nil {
+		return pushed, fmt.Errorf("failed to copy %s to %s: %w", srcRef, dstRef, partialErr)
+	}
+
+	return pushed, nil
+}
+
+// checkImageSize fails with ErrImageTooLarge when the compressed size of the image or index of the
+// given descriptor is larger than maxSize.
+func checkImageSize(desc *remote.Descriptor, maxSize int64) error {
+	size, err := descriptorSize(desc)
+	if err != nil {
+		return fmt.Errorf("failed to compute image size: %w", err)
+	}
+
+	if size > maxSize {
+		return fmt.Errorf("failed to copy image of %d bytes, more than %d: %w", size, maxSize, ErrImageTooLarge)
+	}
+
+	return nil
+}
+
+// descriptorSize returns the compressed size of the image or index of the given descriptor.
+func descriptorSize(desc *remote.Descriptor) (int64, error) {
+	if !desc.MediaType.IsIndex() {
+		img, err := desc.Image()
+		if err != nil {
+			return 0, fmt.Errorf("failed to get image: %w", err)
+		}
+
+		return imageSize(img)
+	}
+
+	idx, err := desc.ImageIndex()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get index: %w", err)
+	}
+
+	return indexSize(idx)
+}
+
+// Destination is a destination of CopyToMany: a reference to write, on the given Registry.
+type Destination struct {
+	Registry *Registry
+	Ref      string
+}
+
+// key returns the key of the destination in the results of CopyToMany: its fully-qualified
+// reference as expanded by its Registry, like "eu.gcr.io/project/app:1", or Ref as is when it
+// has no Registry or can't be parsed.
+func (d Destination) key() string {
+	if d.Registry == nil {
+		return d.Ref
+	}
+
+	ref, err := name.ParseReference(d.Registry.expandReference(d.Ref), d.Registry.nameOptions...)
+	if err != nil {
+		return d.Ref
+	}
+
+	return ref.Name()
+}
+
+// CopyToMany copies an image or an index from srcRef to each of the given destinations,
+// concurrently. The source manifest is fetched once, and its blobs are streamed from the source
+// to each destination missing them. It returns the error of each destination, nil for the
+// successful ones, keyed by its fully-qualified reference (like "eu.gcr.io/project/app:1"), so
+// the destinations of a same ref on different registries are told apart.
+// A destination without Registry fails with ErrNoDestinationRegistry.
+func (r *Registry) CopyToMany(srcRef string, dsts []Destination) map[string]error {
+	src, err := r.parseReference(srcRef)
+	if err != nil {
+		return destinationErrors(dsts, fmt.Errorf("failed to parse image reference %s: %w", srcRef, err))
+	}
+
+	var desc *remote.Descriptor
+
+	err = r.withAuthRefresh(func() error {
+		desc, err = remote.Get(src, r.remoteOptions(withLayerStreaming())...)
+
+		return err
+	})
+	if err != nil {
+		return destinationErrors(dsts, fmt.Errorf("failed to get manifest from remote for image %s: %w", srcRef, err))
+	}
+
+	var (
+		mu    sync.Mutex
+		errs  = make(map[string]error, len(dsts))
+		group errgroup.Group
+	)
+
+	group.SetLimit(defaultConcurrency)
+
+	for _, dst := range dsts {
+		if dst.Registry == nil {
+			mu.Lock()
+			errs[dst.key()] = fmt.Errorf("failed to copy %s to %s: %w", srcRef, dst.Ref, ErrNoDestinationRegistry)
+			mu.Unlock()
+
+			continue
+		}
+
+		group.Go(func() error {
+			err := dst.Registry.writeDescriptor(desc, dst.Ref)
+			if err != nil {
+				err = fmt.Errorf("failed to copy %s to %s: %w", srcRef, dst.Ref, err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			errs[dst.key()] = err
+
+			return nil
+		})
+	}
+
+	_ = group.Wait()
+
+	return errs
+}
+
+// destinationErrors returns the given error for each of the given destinations.
+func destinationErrors(dsts []Destination, err error) map[string]error {
+	errs := make(map[string]error, len(dsts))
+	for _, dst := range dsts {
+		errs[dst.key()] = err
+	}
+
+	return errs
+}
+
+// writeDescriptor writes the image or index of the given descriptor, fetched from another
+// Registry, to dstRef.
+func (r *Registry) writeDescriptor(desc *remote.Descriptor, dstRef string) error {
+	dst, err := r.parseDestination(dstRef)
+	if err != nil {
+		return fmt.Errorf("failed to parse image reference %s: %w", dstRef, err)
+	}
+
+	err = r.withAuthRefresh(func() error {
+		if !desc.MediaType.IsIndex() {
+			img, err := desc.Image()
+			if err != nil {
+				return fmt.Errorf("failed to get image: %w", err)
+			}
+
+			_, err = r.writeImage(dst, img, withLayerStreaming())
+
+			return err
+		}
+
+		idx, err := desc.ImageIndex()
+		if err != nil {
+			return fmt.Errorf("failed to get index: %w", err)
+		}
+
+		return remote.WriteIndex(dst, idx, r.remoteOptions(withLayerStreaming(), withWrite())...)
+	})
+	if err != nil {
+		return err
+	}
+
+	return r.verifyWrite(dst, desc.Digest)
+}
+
+// CopyPlatform copies the image of the given index matching the given platform, as defined by
+// SupportsPlatform, to dstRef as a standalone image, like "myapp:v1-amd64" for consumers not
+// supporting indexes. It fails with ErrPlatformNotFound if no image matches the platform.
+func (r *Registry) CopyPlatform(srcRef string, platform v1.Platform, dstRef string) error {
+	digest, err := r.PlatformDigest(srcRef, platform)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.Copy(digest.String(), dstRef)
+
+	return err
+}
+
+// copyImage writes the image of the given descriptor to dst, applying the copy options.
+func (r *Registry) copyImage(desc *remote.Descriptor, dst name.Reference, co copyOptions) (*v1.Descriptor, error) {
+	img, err := desc.Image()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get image: %w", err)
+	}
+
+	img, err = co.transformImage(img)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.writeImage(dst, img, withLayerStreaming())
+}
+
+// copyIndex writes the index of the given descriptor to dst, applying the copy options to each of its images.
+func (r *Registry) copyIndex(desc *remote.Descriptor, dst name.Reference, co copyOptions) (*v1.Descriptor, error) {
+	idx, err := desc.ImageIndex()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get index: %w", err)
+	}
+
+	idx, err = transformIndex(idx, co.indexMediaType, co.transformImage)
+	if err != nil {
+		return nil, err
+	}
+
+	var partialErr error
+
+	if co.bestEffort {
+		idx, partialErr = r.writeIndexChildren(idx, dst.Context())
+		if idx == nil {
+			return nil, partialErr
+		}
+	}
+
+	err = remote.WriteIndex(dst, idx, r.remoteOptions(withLayerStreaming(), withWrite())...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write index: %w", err)
+	}
+
+	pushed, err := partial.Descriptor(idx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute index descriptor: %w", err)
+	}
+
+	return pushed, partialErr
+}
+
+// writeIndexChildren writes each child of the given index to the repository by digest, and
+// returns the index without the children that failed, along with an ErrPartialCopy error listing
+// them. If all the children fail, no index is returned.
+func (r *Registry) writeIndexChildren(idx v1.ImageIndex, repo name.Repository) (v1.ImageIndex, error) {
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get index manifest: %w", err)
+	}
+
+	var (
+		failed = make(map[v1.Hash]bool)
+		errs   []error
+	)
+
+	for _, child := range manifest.Manifests {
+		err := r.writeIndexChild(idx, repo.Digest(child.Digest.String()), child)
+		if err != nil {
+			platform := child.Digest.String()
+			if child.Platform != nil {
+				platform = child.Platform.String()
+			}
+
+			failed[child.Digest] = true
+			errs = append(errs, fmt.Errorf("failed to copy platform %s: %w", platform, err))
+		}
+	}
+
+	switch {
+	case len(errs) == 0:
+		return idx, nil
+	case len(errs) == len(manifest.Manifests):
+		return nil, fmt.Errorf("failed to copy all the images of the index: %w", errors.Join(errs...))
+	default:
+		reduced := mutate.RemoveManifests(idx, func(desc v1.Descriptor) bool {
+			return failed[desc.Digest]
+		})
+
+		return reduced, fmt.Errorf("failed to copy %d of %d images: %w",
+			len(errs), len(manifest.Manifests), errors.Join(append([]error{ErrPartialCopy}, errs...)...))
+	}
+}
+
+// writeIndexChild writes the given child of the index to dst.
+func (r *Registry) writeIndexChild(idx v1.ImageIndex, dst name.Digest, child v1.Descriptor) error {
+	options := r.remoteOptions(withLayerStreaming(), withWrite())
+
+	if child.MediaType.IsIndex() {
+		childIdx, err := idx.ImageIndex(child.Digest)
+		if err != nil {
+			return fmt.Errorf("failed to get index %s: %w", child.Digest, err)
+		}
+
+		return remote.WriteIndex(dst, childIdx, options...) //nolint:wrapcheck
+	}
+
+	img, err := idx.Image(child.Digest)
+	if err != nil {
+		return fmt.Errorf("failed to get image %s: %w", child.Digest, err)
+	}
+
+	return remote.Write(dst, img, options...) //nolint:wrapcheck
+}
+
+// PushOption configures a Push.
+type PushOption func(*pushOptions)
+
+// pushOptions holds the configuration of a Push.
+type pushOptions struct {
+	annotations map[string]string
+}
+
+// WithPushAnnotations sets the given annotations on the manifest of the pushed image, like a build
+// ID or a git SHA, in addition to its own. The digest of the pushed image changes accordingly.
+func WithPushAnnotations(annotations map[string]string) PushOption {
+	return func(po *pushOptions) {
+		po.annotations = annotations
+	}
+}
+
+// Push writes the given image to imageRef, and returns the descriptor of the pushed manifest.
+func (r *Registry) Push(imageRef string, img v1.Image, opts ...PushOption) (*v1.Descriptor, error) {
+	pushed, err := r.push(imageRef, img, opts...)
+	r.emit("Push", imageRef, descriptorDigest(pushed), err)
+
+	return pushed, err
+}
+
+// push implements Push.
+func (r *Registry) push(imageRef string, img v1.Image, opts ...PushOption) (*v1.Descriptor, error) {
+	var po pushOptions
+	for _, opt := range opts {
+		opt(&po)
+	}
+
+	dst, err := r.parseDestination(imageRef)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse image reference %s: %w", imageRef, err)
+	}
+
+	if len(po.annotations) > 0 {
+		img, _ = mutate.Annotations(img, po.annotations).(v1.Image)
+	}
+
+	var pushed *v1.Descriptor
+
+	err = r.withAuthRefresh(func() error {
+		pushed, err = r.writeImage(dst, img, withLayerStreaming())
+
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to push image %s: %w", imageRef, err)
+	}
+
+	err = r.verifyWrite(dst, pushed.Digest)
+	if err != nil {
+		return nil, err
+	}
+
+	return pushed, nil
+}
+
+// writeImage writes the given image to dst, and returns the descriptor of its manifest.
+func (r *Registry) writeImage(dst name.Reference, img v1.Image, opts ...CallOption) (*v1.Descriptor, error) {
+	err := remote.Write(dst, img, r.remoteOptions(append(opts, withWrite())...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write image: %w", err)
+	}
+
+	pushed, err := partial.Descriptor(img)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute image descriptor: %w", err)
+	}
+
+	return pushed, nil
+}
+
+// transformImage applies the copy options modifying the content of an image.
+func (co copyOptions) transformImage(img v1.Image) (v1.Image, error) {
+	var err error
+
+	src := img
+
+	if len(co.layerFilters) > 0 {
+		img, err = co.filterLayers(img)
+		if err != nil {
+			return nil, fmt.Errorf("failed to filter image layers: %w", err)
+		}
+	}
+
+	if co.recompress != "" {
+		img, err = recompressImage(img, co.recompress)
+		if err != nil {
+			return nil, fmt.Errorf("failed to recompress image layers: %w", err)
+		}
+	}
+
+	if co.conversion != noConversion {
+		img, err = convertImage(img, co.conversion)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert image media types: %w", err)
+		}
+	}
+
+	if typed, ok := img.(artifactTypedImage); ok && co.retype {
+		img = typed.Image
+	}
+
+	err = co.reportImage(src, img)
+	if err != nil {
+		return nil, err
+	}
+
+	return img, nil
+}
+
+// indexMediaType returns the media type of an index copied with the copy options.
+func (co copyOptions) indexMediaType(mediaType types.MediaType) types.MediaType {
+	mediaType = co.conversion.convert(mediaType)
+	if co.recompress == CompressionZstd {
+		mediaType = convertToOCI.convert(mediaType)
+	}
+
+	return mediaType
+}
+
+// descriptorDigest returns the digest of the given descriptor, or a zero hash if it is nil.
+func descriptorDigest(desc *v1.Descriptor) v1.Hash {
+	if desc == nil {
+		return v1.Hash{}
+	}
+
+	return desc.Digest
+}
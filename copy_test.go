@@ -0,0 +1,70 @@
+package registry
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+func TestCopyToMany(t *testing.T) {
+	t.Parallel()
+
+	srcHost := startTestRegistry(t, nil)
+	euHost := startTestRegistry(t, nil)
+	usHost := startTestRegistry(t, nil)
+
+	img, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatalf("random.Image() error = %v", err)
+	}
+
+	src, err := name.ParseReference(srcHost + "/test/app:1")
+	if err != nil {
+		t.Fatalf("name.ParseReference() error = %v", err)
+	}
+
+	err = remote.Write(src, img)
+	if err != nil {
+		t.Fatalf("remote.Write() error = %v", err)
+	}
+
+	r, err := New(srcHost)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	// The regional registries are given the same bare ref, scoped by their repository prefix.
+	eu, err := New(euHost, WithRepositoryPrefix(euHost+"/mirror"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	us, err := New(usHost, WithRepositoryPrefix(usHost+"/mirror"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	errs := r.CopyToMany(src.String(), []Destination{
+		{Registry: eu, Ref: "app:1"},
+		{Registry: us, Ref: "app:1"},
+		{Ref: "orphan:1"},
+	})
+
+	if len(errs) != 3 {
+		t.Fatalf("CopyToMany() returned %d results, want 3: %v", len(errs), errs)
+	}
+
+	for _, key := range []string{euHost + "/mirror/app:1", usHost + "/mirror/app:1"} {
+		err, ok := errs[key]
+		if !ok || err != nil {
+			t.Errorf("CopyToMany()[%s] = %v (present: %t), want a nil error", key, err, ok)
+		}
+	}
+
+	if err := errs["orphan:1"]; !errors.Is(err, ErrNoDestinationRegistry) {
+		t.Errorf("CopyToMany()[orphan:1] = %v, want %v", err, ErrNoDestinationRegistry)
+	}
+}
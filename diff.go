@@ -0,0 +1,149 @@
+package registry
+
+import (
+	"fmt"
+	"slices"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// DiffLayers compares the layers of two images and returns the layer digests only present in refB
+// (added), the ones only present in refA (removed) and the ones present in both (common).
+//
+// Indexes are compared platform by platform, and the results of each platform are aggregated.
+// Their attestation manifests are ignored (see Attestations).
+func (r *Registry) DiffLayers(refA, refB string) ([]v1.Hash, []v1.Hash, []v1.Hash, error) {
+	layersA, err := r.layersByPlatform(refA)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	layersB, err := r.layersByPlatform(refB)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var added, removed, common []v1.Hash
+
+	appendUnique := func(hashes []v1.Hash, h v1.Hash) []v1.Hash {
+		if slices.Contains(hashes, h) {
+			return hashes
+		}
+
+		return append(hashes, h)
+	}
+
+	for platform, a := range layersA {
+		b := layersB[platform]
+
+		for _, h := range a {
+			if slices.Contains(b, h) {
+				common = appendUnique(common, h)
+			} else {
+				removed = appendUnique(removed, h)
+			}
+		}
+	}
+
+	for platform, b := range layersB {
+		a := layersA[platform]
+
+		for _, h := range b {
+			if !slices.Contains(a, h) {
+				added = appendUnique(added, h)
+			}
+		}
+	}
+
+	return added, removed, common, nil
+}
+
+// layersByPlatform returns the layer digests of the given image ref, keyed by platform.
+// A single-platform image is keyed by the platform found in its config.
+func (r *Registry) layersByPlatform(imageRef string) (map[string][]v1.Hash, error) {
+	ref, err := r.parseReference(imageRef)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse image reference %s: %w", imageRef, err)
+	}
+
+	var desc *remote.Descriptor
+
+	err = r.withAuthRefresh(func() error {
+		desc, err = remote.Get(ref, r.remoteOptions()...)
+
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get manifest from remote for image %s: %w", imageRef, err)
+	}
+
+	layers := make(map[string][]v1.Hash)
+
+	if desc.MediaType.IsIndex() {
+		index, err := desc.ImageIndex()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get index from remote for image %s: %w", imageRef, err)
+		}
+
+		manifest, err := index.IndexManifest()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get index manifest from remote for image %s: %w", imageRef, err)
+		}
+
+		for _, child := range manifest.Manifests {
+			if !child.MediaType.IsImage() || child.Platform == nil || isAttestation(child) {
+				continue
+			}
+
+			img, err := index.Image(child.Digest)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get image %s from remote for image %s: %w", child.Digest, imageRef, err)
+			}
+
+			layers[child.Platform.String()], err = layerDigests(img)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get layers of image %s for image %s: %w", child.Digest, imageRef, err)
+			}
+		}
+
+		return layers, nil
+	}
+
+	img, err := desc.Image()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get image details from remote for image %s: %w", imageRef, err)
+	}
+
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get image details from remote for image %s: %w", imageRef, err)
+	}
+
+	var platform string
+	if p := cfg.Platform(); p != nil {
+		platform = p.String()
+	}
+
+	layers[platform], err = layerDigests(img)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get layers for image %s: %w", imageRef, err)
+	}
+
+	return layers, nil
+}
+
+// layerDigests returns the digests of the layers of the given image, as listed in its manifest.
+func layerDigests(img v1.Image) ([]v1.Hash, error) {
+	manifest, err := img.Manifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get manifest: %w", err)
+	}
+
+	digests := make([]v1.Hash, 0, len(manifest.Layers))
+	for _, layer := range manifest.Layers {
+		digests = append(digests, layer.Digest)
+	}
+
+	return digests, nil
+}
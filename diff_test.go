@@ -0,0 +1,61 @@
+package registry
+
+import (
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+func TestDiffLayersIgnoresAttestations(t *testing.T) {
+	t.Parallel()
+
+	host := startTestRegistry(t, nil)
+	idx := newAttestedIndex(t)
+
+	ref, err := name.ParseReference(host + "/test/app:latest")
+	if err != nil {
+		t.Fatalf("name.ParseReference() error = %v", err)
+	}
+
+	err = remote.WriteIndex(ref, idx)
+	if err != nil {
+		t.Fatalf("remote.WriteIndex() error = %v", err)
+	}
+
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		t.Fatalf("idx.IndexManifest() error = %v", err)
+	}
+
+	img, err := idx.Image(manifest.Manifests[0].Digest)
+	if err != nil {
+		t.Fatalf("idx.Image() error = %v", err)
+	}
+
+	imgManifest, err := img.Manifest()
+	if err != nil {
+		t.Fatalf("img.Manifest() error = %v", err)
+	}
+
+	r, err := New(host)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	// The index compared with its own image: only the attestation differs.
+	imageRef := ref.Context().Digest(manifest.Manifests[0].Digest.String())
+
+	added, removed, common, err := r.DiffLayers(ref.String(), imageRef.String())
+	if err != nil {
+		t.Fatalf("DiffLayers() error = %v", err)
+	}
+
+	if len(added) != 0 || len(removed) != 0 {
+		t.Errorf("DiffLayers() added = %v, removed = %v, want none", added, removed)
+	}
+
+	if len(common) != len(imgManifest.Layers) {
+		t.Errorf("DiffLayers() common = %v, want the %d layers of the image", common, len(imgManifest.Layers))
+	}
+}
@@ -0,0 +1,60 @@
+package registry
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// sha256HexLength is the length of the hex-encoded part of a sha256 digest.
+const sha256HexLength = 64
+
+// ErrInvalidDigest is returned by NormalizeDigest when the given string is not a sha256 digest.
+var ErrInvalidDigest = errors.New("invalid sha256 digest")
+
+// NormalizeDigest validates the given sha256 digest and returns its canonical form,
+// "sha256:<lowercase-hex>". The algorithm prefix is optional and both parts are case-insensitive,
+// so "SHA256:ABC..." and a bare "abc..." are accepted. It fails with ErrInvalidDigest otherwise.
+// The methods taking a digest (PointTag, FetchArtifact...) or a digest reference normalize it.
+func NormalizeDigest(s string) (string, error) {
+	digest := strings.ToLower(strings.TrimSpace(s))
+
+	algorithm, encoded, ok := strings.Cut(digest, ":")
+	if !ok {
+		algorithm, encoded = "sha256", digest
+	}
+
+	if algorithm != "sha256" {
+		return "", fmt.Errorf("failed to normalize digest %q with algorithm %s: %w", s, algorithm, ErrInvalidDigest)
+	}
+
+	if _, err := hex.DecodeString(encoded); err != nil || len(encoded) != sha256HexLength {
+		return "", fmt.Errorf("failed to normalize digest %q: %w", s, ErrInvalidDigest)
+	}
+
+	return algorithm + ":" + encoded, nil
+}
+
+// DigestOf computes the manifest digest of the given image in memory, without contacting any
+// registry: it is the digest the image gets once pushed, and can be compared to a remote one.
+func DigestOf(img v1.Image) (v1.Hash, error) {
+	digest, err := img.Digest()
+	if err != nil {
+		return v1.Hash{}, fmt.Errorf("failed to compute image digest: %w", err)
+	}
+
+	return digest, nil
+}
+
+// DigestOfIndex computes the manifest digest of the given index in memory, like DigestOf.
+func DigestOfIndex(idx v1.ImageIndex) (v1.Hash, error) {
+	digest, err := idx.Digest()
+	if err != nil {
+		return v1.Hash{}, fmt.Errorf("failed to compute index digest: %w", err)
+	}
+
+	return digest, nil
+}
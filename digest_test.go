@@ -0,0 +1,83 @@
+package registry
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+func TestNormalizeDigest(t *testing.T) {
+	t.Parallel()
+
+	const hexDigest = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+	tests := []struct {
+		name    string
+		digest  string
+		want    string
+		wantErr error
+	}{
+		{name: "canonical", digest: "sha256:" + hexDigest, want: "sha256:" + hexDigest},
+		{name: "uppercase", digest: "SHA256:" + strings.ToUpper(hexDigest), want: "sha256:" + hexDigest},
+		{name: "bare", digest: hexDigest, want: "sha256:" + hexDigest},
+		{name: "surrounding spaces", digest: " sha256:" + hexDigest + "\n", want: "sha256:" + hexDigest},
+		{name: "other algorithm", digest: "sha512:" + hexDigest, wantErr: ErrInvalidDigest},
+		{name: "too short", digest: "sha256:" + hexDigest[1:], wantErr: ErrInvalidDigest},
+		{name: "not hex", digest: "sha256:" + strings.Repeat("z", sha256HexLength), wantErr: ErrInvalidDigest},
+		{name: "empty", digest: "", wantErr: ErrInvalidDigest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := NormalizeDigest(tt.digest)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("NormalizeDigest() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("NormalizeDigest() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDigestOfIndex(t *testing.T) {
+	t.Parallel()
+
+	host := startTestRegistry(t, nil)
+
+	idx, err := random.Index(1024, 1, 2)
+	if err != nil {
+		t.Fatalf("random.Index() error = %v", err)
+	}
+
+	got, err := DigestOfIndex(idx)
+	if err != nil {
+		t.Fatalf("DigestOfIndex() error = %v", err)
+	}
+
+	ref, err := name.ParseReference(host + "/test/index:latest")
+	if err != nil {
+		t.Fatalf("name.ParseReference() error = %v", err)
+	}
+
+	err = remote.WriteIndex(ref, idx)
+	if err != nil {
+		t.Fatalf("remote.WriteIndex() error = %v", err)
+	}
+
+	head, err := remote.Head(ref)
+	if err != nil {
+		t.Fatalf("remote.Head() error = %v", err)
+	}
+
+	if got != head.Digest {
+		t.Errorf("DigestOfIndex() = %s, want the digest of the pushed index %s", got, head.Digest)
+	}
+}
@@ -0,0 +1,85 @@
+package registry
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+// isUnauthorized reports whether the given error is a 401 returned by the registry.
+func isUnauthorized(err error) bool {
+	return hasStatusCode(err, http.StatusUnauthorized)
+}
+
+// isNotFound reports whether the given error is a 404 returned by the registry.
+func isNotFound(err error) bool {
+	return hasStatusCode(err, http.StatusNotFound)
+}
+
+// hasStatusCode reports whether the given error is a transport.Error with the given status code.
+func hasStatusCode(err error, statusCode int) bool {
+	var tErr *transport.Error
+
+	return errors.As(err, &tErr) && tErr.StatusCode == statusCode
+}
+
+// RegistryError is the interpretation of an error response of the registry.
+type RegistryError struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+	// Codes are the error codes of the response body, such as MANIFEST_UNKNOWN or DENIED.
+	Codes []transport.ErrorCode
+	// Message is a human readable description of the error.
+	Message string
+
+	err *transport.Error
+}
+
+// Error implements error.
+func (e *RegistryError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the underlying transport.Error.
+func (e *RegistryError) Unwrap() error {
+	return e.err
+}
+
+// HasCode reports whether the response holds the given error code.
+func (e *RegistryError) HasCode(code transport.ErrorCode) bool {
+	return slices.Contains(e.Codes, code)
+}
+
+// AsRegistryError extracts the error response of the registry wrapped in err, if any.
+func AsRegistryError(err error) (*RegistryError, bool) {
+	var tErr *transport.Error
+	if !errors.As(err, &tErr) {
+		return nil, false
+	}
+
+	rErr := &RegistryError{
+		StatusCode: tErr.StatusCode,
+		Codes:      make([]transport.ErrorCode, 0, len(tErr.Errors)),
+		err:        tErr,
+	}
+
+	messages := make([]string, 0, len(tErr.Errors))
+
+	for _, diagnostic := range tErr.Errors {
+		rErr.Codes = append(rErr.Codes, diagnostic.Code)
+
+		if diagnostic.Message != "" {
+			messages = append(messages, diagnostic.Message)
+		}
+	}
+
+	rErr.Message = strings.Join(messages, "; ")
+	if rErr.Message == "" {
+		rErr.Message = http.StatusText(tErr.StatusCode)
+	}
+
+	return rErr, true
+}
@@ -0,0 +1,66 @@
+package registry
+
+import (
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// Outcome is the result of an operation reported in an Event.
+type Outcome string
+
+const (
+	// OutcomeSuccess is the outcome of an operation that succeeded.
+	OutcomeSuccess Outcome = "success"
+	// OutcomeFailure is the outcome of an operation that failed.
+	OutcomeFailure Outcome = "failure"
+)
+
+// Event describes an operation performed on the registry, emitted to the EventSink set with WithEventSink.
+type Event struct {
+	// Operation is the name of the Registry method, like "Copy".
+	Operation string
+	// Reference is the reference the operation was performed on, as given to the method
+	// (the destination for a write).
+	Reference string
+	// Digest is the digest of the manifest read or written, when known. For the methods resolving
+	// an index to a single image, like Image or Inspect, it is the digest of that image.
+	Digest string
+	// Outcome tells whether the operation succeeded.
+	Outcome Outcome
+	// Err is the error of a failed operation.
+	Err error
+	// Time is the time the operation completed at, according to the Clock of the Registry.
+	Time time.Time
+}
+
+// EventSink receives the events of the operations performed by a Registry. Emit is called
+// synchronously, possibly from several goroutines at once.
+type EventSink interface {
+	Emit(event Event)
+}
+
+// emit sends the event of a completed operation to the event sink, if any.
+func (r *Registry) emit(operation, reference string, digest v1.Hash, err error) {
+	if r.eventSink == nil {
+		return
+	}
+
+	event := Event{
+		Operation: operation,
+		Reference: reference,
+		Outcome:   OutcomeSuccess,
+		Err:       err,
+		Time:      r.clock.Now(),
+	}
+
+	if digest != (v1.Hash{}) {
+		event.Digest = digest.String()
+	}
+
+	if err != nil {
+		event.Outcome = OutcomeFailure
+	}
+
+	r.eventSink.Emit(event)
+}
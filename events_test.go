@@ -0,0 +1,76 @@
+package registry
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// recordingSink is an EventSink recording the events it receives.
+type recordingSink struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (s *recordingSink) Emit(event Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.events = append(s.events, event)
+}
+
+func TestReadEventsHaveDigest(t *testing.T) {
+	t.Parallel()
+
+	host := startTestRegistry(t, nil)
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() error = %v", err)
+	}
+
+	ref, err := name.ParseReference(host + "/test/app:latest")
+	if err != nil {
+		t.Fatalf("name.ParseReference() error = %v", err)
+	}
+
+	err = remote.Write(ref, img)
+	if err != nil {
+		t.Fatalf("remote.Write() error = %v", err)
+	}
+
+	digest, err := img.Digest()
+	if err != nil {
+		t.Fatalf("img.Digest() error = %v", err)
+	}
+
+	sink := &recordingSink{}
+
+	r, err := New(host, WithEventSink(sink))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	_, err = r.Image(ref.String())
+	if err != nil {
+		t.Fatalf("Image() error = %v", err)
+	}
+
+	_, err = r.Inspect(ref.String())
+	if err != nil {
+		t.Fatalf("Inspect() error = %v", err)
+	}
+
+	if len(sink.events) != 2 {
+		t.Fatalf("emitted events = %+v, want 2", sink.events)
+	}
+
+	for _, event := range sink.events {
+		if event.Digest != digest.String() || event.Outcome != OutcomeSuccess {
+			t.Errorf("%s event = %+v, want a success with digest %s", event.Operation, event, digest)
+		}
+	}
+}
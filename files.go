@@ -0,0 +1,49 @@
+package registry
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+)
+
+// WalkFiles streams the layers of the given image without writing them to disk, and calls fn for
+// each entry of the resulting filesystem with its header and a reader of its content. Whiteouts
+// are applied, so deleted files and the files overwritten by upper layers aren't presented. For
+// an index, the image matching the default platform is walked.
+//
+// The iteration stops at the first error returned by fn, which is returned by WalkFiles, unless
+// it is StopIteration.
+func (r *Registry) WalkFiles(imageRef string, fn func(path string, info tar.Header, r io.Reader) error) error {
+	img, err := r.Image(imageRef, withLayerStreaming())
+	if err != nil {
+		return err
+	}
+
+	rc := mutate.Extract(img)
+	defer rc.Close()
+
+	tr := tar.NewReader(rc)
+
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to read layers of image %s: %w", imageRef, err)
+		}
+
+		err = fn(hdr.Name, *hdr, tr)
+		if errors.Is(err, StopIteration) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
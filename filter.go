@@ -0,0 +1,141 @@
+package registry
+
+import (
+	"fmt"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+)
+
+// WithLayerFilter drops from the copied images the layers for which keep returns false, removing
+// them from the manifest and from the rootfs and history of the config. It can be given several
+// times, a layer being kept only if all the filters keep it.
+//
+// The digest of the images with dropped layers, and therefore of the copied content, changes.
+func WithLayerFilter(keep func(v1.Descriptor) bool) CopyOption {
+	return func(co *copyOptions) {
+		co.layerFilters = append(co.layerFilters, keep)
+	}
+}
+
+// WithSkipForeignLayers drops the non-distributable layers (like the foreign layers of Windows
+// images) from the copied images, see WithLayerFilter.
+func WithSkipForeignLayers() CopyOption {
+	return WithLayerFilter(func(desc v1.Descriptor) bool {
+		return desc.MediaType.IsDistributable()
+	})
+}
+
+// keepLayer reports whether the given layer passes all the layer filters of the copy options.
+func (co copyOptions) keepLayer(desc v1.Descriptor) bool {
+	for _, keep := range co.layerFilters {
+		if !keep(desc) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// filterLayers rebuilds the given image without the layers dropped by the layer filters of the
+// copy options. The image is returned unchanged if no layer is dropped.
+func (co copyOptions) filterLayers(img v1.Image) (v1.Image, error) {
+	manifest, err := img.Manifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get manifest: %w", err)
+	}
+
+	dropped := make(map[int]bool)
+
+	for i, desc := range manifest.Layers {
+		if !co.keepLayer(desc) {
+			dropped[i] = true
+		}
+	}
+
+	if len(dropped) == 0 {
+		return img, nil
+	}
+
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config: %w", err)
+	}
+
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get layers: %w", err)
+	}
+
+	cfg = cfg.DeepCopy()
+	cfg.RootFS.DiffIDs = nil
+	cfg.History = filteredHistory(cfg.History, dropped)
+
+	addenda := make([]mutate.Addendum, 0, len(layers)-len(dropped))
+
+	for i, layer := range layers {
+		if dropped[i] {
+			continue
+		}
+
+		diffID, err := layer.DiffID()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get diff id of layer %s: %w", manifest.Layers[i].Digest, err)
+		}
+
+		cfg.RootFS.DiffIDs = append(cfg.RootFS.DiffIDs, diffID)
+		addenda = append(addenda, mutate.Addendum{
+			Layer:       layer,
+			MediaType:   manifest.Layers[i].MediaType,
+			URLs:        manifest.Layers[i].URLs,
+			Annotations: manifest.Layers[i].Annotations,
+		})
+	}
+
+	base := mutate.MediaType(empty.Image, manifest.MediaType)
+	base = mutate.ConfigMediaType(base, manifest.Config.MediaType)
+
+	filtered, err := mutate.Append(base, addenda...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to append layers: %w", err)
+	}
+
+	filtered, err = mutate.ConfigFile(filtered, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set config: %w", err)
+	}
+
+	if len(manifest.Annotations) > 0 {
+		filtered, _ = mutate.Annotations(filtered, manifest.Annotations).(v1.Image)
+	}
+
+	if manifest.Subject != nil {
+		filtered, _ = mutate.Subject(filtered, *manifest.Subject).(v1.Image)
+	}
+
+	return keepArtifactType(img, filtered)
+}
+
+// filteredHistory returns the given history without the entries of the dropped layers, the
+// entries of empty layers being kept.
+func filteredHistory(history []v1.History, dropped map[int]bool) []v1.History {
+	filtered := make([]v1.History, 0, len(history))
+	layer := 0
+
+	for _, entry := range history {
+		if entry.EmptyLayer {
+			filtered = append(filtered, entry)
+
+			continue
+		}
+
+		if !dropped[layer] {
+			filtered = append(filtered, entry)
+		}
+
+		layer++
+	}
+
+	return filtered
+}
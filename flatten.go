@@ -0,0 +1,91 @@
+package registry
+
+import (
+	"fmt"
+	"io"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// Flatten squashes all the layers of the given image into a single one, applying whiteouts so
+// deleted files don't reappear. The config of the image (env, entrypoint...) is kept, and the
+// history entry of the flattened layer is dated with its creation time, so flattening the same
+// image always gives the same digest.
+//
+// The flattened layer isn't stored: the layers of the source image are downloaded and extracted
+// once to compute its digest, then every time its content is read.
+func (r *Registry) Flatten(imageRef string) (v1.Image, error) {
+	img, err := r.Image(imageRef, withLayerStreaming())
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := img.Manifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get manifest for image %s: %w", imageRef, err)
+	}
+
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get image details for image %s: %w", imageRef, err)
+	}
+
+	layerMediaType := types.DockerLayer
+	if manifest.MediaType == types.OCIManifestSchema1 {
+		layerMediaType = types.OCILayer
+	}
+
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return mutate.Extract(img), nil
+	}, tarball.WithMediaType(layerMediaType))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create flattened layer for image %s: %w", imageRef, err)
+	}
+
+	cfg = cfg.DeepCopy()
+	cfg.RootFS.DiffIDs = nil
+	cfg.History = nil
+
+	base, err := mutate.ConfigFile(mutate.MediaType(empty.Image, manifest.MediaType), cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set config for image %s: %w", imageRef, err)
+	}
+
+	flattened, err := mutate.Append(base, mutate.Addendum{
+		Layer: layer,
+		History: v1.History{
+			Created:   cfg.Created,
+			CreatedBy: "flattened from " + imageRef,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to append flattened layer for image %s: %w", imageRef, err)
+	}
+
+	return flattened, nil
+}
+
+// ExportFlattened flattens the given image and writes it as a tarball to destPath, in the format
+// expected by `docker load`.
+func (r *Registry) ExportFlattened(imageRef, destPath string) error {
+	ref, err := r.parseReference(imageRef)
+	if err != nil {
+		return fmt.Errorf("failed to parse image reference %s: %w", imageRef, err)
+	}
+
+	flattened, err := r.Flatten(imageRef)
+	if err != nil {
+		return err
+	}
+
+	err = tarball.WriteToFile(destPath, ref, flattened)
+	if err != nil {
+		return fmt.Errorf("failed to write flattened image %s to %s: %w", imageRef, destPath, err)
+	}
+
+	return nil
+}
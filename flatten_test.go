@@ -0,0 +1,78 @@
+package registry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+func TestFlattenIsReproducible(t *testing.T) {
+	t.Parallel()
+
+	host := startTestRegistry(t, nil)
+	clock := newFakeClock()
+
+	img, err := random.Image(1024, 3)
+	if err != nil {
+		t.Fatalf("random.Image() error = %v", err)
+	}
+
+	created := v1.Time{Time: clock.Now().Add(-24 * time.Hour)}
+
+	img, err = mutate.CreatedAt(img, created)
+	if err != nil {
+		t.Fatalf("mutate.CreatedAt() error = %v", err)
+	}
+
+	ref, err := name.ParseReference(host + "/test/app:latest")
+	if err != nil {
+		t.Fatalf("name.ParseReference() error = %v", err)
+	}
+
+	err = remote.Write(ref, img)
+	if err != nil {
+		t.Fatalf("remote.Write() error = %v", err)
+	}
+
+	r, err := New(host, WithClock(clock))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	var digests []v1.Hash
+
+	for range 2 {
+		flattened, err := r.Flatten(ref.String())
+		if err != nil {
+			t.Fatalf("Flatten() error = %v", err)
+		}
+
+		digest, err := flattened.Digest()
+		if err != nil {
+			t.Fatalf("Digest() error = %v", err)
+		}
+
+		digests = append(digests, digest)
+
+		cfg, err := flattened.ConfigFile()
+		if err != nil {
+			t.Fatalf("ConfigFile() error = %v", err)
+		}
+
+		if len(cfg.History) != 1 || !cfg.History[0].Created.Equal(created.Time) {
+			t.Errorf("Flatten() history = %+v, want a single entry created at %s", cfg.History, created)
+		}
+
+		// Time goes by between the two flattenings.
+		<-clock.After(time.Hour)
+	}
+
+	if digests[0] != digests[1] {
+		t.Errorf("Flatten() digests = %v, want the same digest twice", digests)
+	}
+}
@@ -2,11 +2,15 @@ module github.com/radiofrance/go-containerregistry
 
 go 1.26.2
 
-require github.com/google/go-containerregistry v0.21.5
+require (
+	github.com/Masterminds/semver/v3 v3.5.0
+	github.com/docker/cli v29.4.0+incompatible
+	github.com/google/go-containerregistry v0.21.5
+	golang.org/x/sync v0.20.0
+)
 
 require (
 	github.com/containerd/stargz-snapshotter/estargz v0.18.2 // indirect
-	github.com/docker/cli v29.4.0+incompatible // indirect
 	github.com/docker/docker-credential-helpers v0.9.3 // indirect
 	github.com/klauspost/compress v1.18.5 // indirect
 	github.com/mitchellh/go-homedir v1.1.0 // indirect
@@ -14,7 +18,6 @@ require (
 	github.com/opencontainers/image-spec v1.1.1 // indirect
 	github.com/sirupsen/logrus v1.9.4 // indirect
 	github.com/vbatts/tar-split v0.12.2 // indirect
-	golang.org/x/sync v0.20.0 // indirect
 	golang.org/x/sys v0.43.0 // indirect
 	gotest.tools/v3 v3.5.2 // indirect
 )
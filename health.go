@@ -0,0 +1,227 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// probeRepository is the repository the referrers API is probed on when the URL of the
+	// Registry has none.
+	probeRepository = "probe"
+	// probeDigest is the digest the referrers API is probed with, the one of empty content.
+	probeDigest = "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// ProbeResult holds the capabilities of a registry, as reported by Probe.
+type ProbeResult struct {
+	// Reachable is true when the registry responded to HTTP requests.
+	Reachable bool
+	// V2 is true when the /v2/ endpoint responded with 200, or with 401 when authentication is required.
+	V2 bool
+	// APIVersion is the value of the Docker-Distribution-API-Version header of the /v2/ endpoint.
+	APIVersion string
+	// AuthRequired is true when the /v2/ endpoint requires authentication.
+	AuthRequired bool
+	// Catalog is true when the _catalog endpoint is supported and accessible with the credentials.
+	Catalog bool
+	// Referrers is true when the OCI referrers API is supported.
+	Referrers bool
+}
+
+// Probe diagnoses the registry: it checks that it is reachable and that its /v2/ endpoint
+// responds, reads the advertised API version and whether authentication is required, then checks
+// with the credentials of the Registry whether the _catalog endpoint and the referrers API (on the
+// repository of the URL, or on a "probe" repository) are supported. Only a registry that can't be
+// reached fails, along with a result telling so.
+func (r *Registry) Probe(ctx context.Context) (*ProbeResult, error) {
+	reg, err := r.registry()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse registry %s: %w", r.URL, err)
+	}
+
+	var result ProbeResult
+
+	uri := url.URL{
+		Scheme: reg.Scheme(),
+		Host:   reg.RegistryStr(),
+		Path:   "/v2/",
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	client := http.Client{Transport: r.transport(callOptions{})}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return &result, fmt.Errorf("failed to reach registry %s: %w", reg, err)
+	}
+	defer resp.Body.Close()
+
+	result.Reachable = true
+	result.V2 = resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusUnauthorized
+	result.APIVersion = resp.Header.Get(apiVersionHeader)
+	result.AuthRequired = resp.StatusCode == http.StatusUnauthorized
+
+	if !result.V2 {
+		return &result, nil
+	}
+
+	err = r.probeEndpoint(ctx, reg, "registry:catalog:*", url.URL{Path: "/v2/_catalog", RawQuery: "n=1"})
+	result.Catalog = err == nil
+
+	repo := reg.Repo(probeRepository)
+	if strings.Contains(r.URL, "/") {
+		repo, err = name.NewRepository(r.URL, r.nameOptions...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse repository %s: %w", r.URL, err)
+		}
+	}
+
+	err = r.probeEndpoint(ctx, reg, repo.Scope(transport.PullScope),
+		url.URL{Path: fmt.Sprintf("/v2/%s/referrers/%s", repo.RepositoryStr(), probeDigest)})
+
+	// A registry supporting the referrers API may not know the probed repository.
+	regErr, ok := AsRegistryError(err)
+	result.Referrers = err == nil ||
+		ok && regErr.StatusCode == http.StatusNotFound && regErr.HasCode(transport.NameUnknownErrorCode)
+
+	return &result, nil
+}
+
+// probeEndpoint sends an authenticated GET request for the given scope to the given endpoint of
+// the registry, and returns an error unless it responds with 200.
+func (r *Registry) probeEndpoint(ctx context.Context, reg name.Registry, scope string, endpoint url.URL) error {
+	auth, err := r.targetAuthenticator(reg)
+	if err != nil {
+		return err
+	}
+
+	rt, err := transport.NewWithContext(ctx, reg, auth, r.transport(callOptions{}), []string{scope})
+	if err != nil {
+		return fmt.Errorf("failed to create transport for scope %s: %w", scope, err)
+	}
+
+	endpoint.Scheme = reg.Scheme()
+	endpoint.Host = reg.RegistryStr()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.String(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := (&http.Client{Transport: rt}).Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	return transport.CheckError(resp, http.StatusOK) //nolint:wrapcheck
+}
+
+// Healthz sends an unauthenticated request to the /v2/ endpoint of the registry, and reports
+// whether the registry is up: it is when it responds with 200, or with 401 as it is then up but
+// requires authentication. Connection errors and other statuses, like 5xx, are returned as errors.
+func (r *Registry) Healthz(ctx context.Context) error {
+	reg, err := r.registry()
+	if err != nil {
+		return fmt.Errorf("failed to parse registry %s: %w", r.URL, err)
+	}
+
+	uri := url.URL{
+		Scheme: reg.Scheme(),
+		Host:   reg.RegistryStr(),
+		Path:   "/v2/",
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri.String(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	client := http.Client{Transport: r.transport(callOptions{})}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach registry %s: %w", reg, err)
+	}
+	defer resp.Body.Close()
+
+	err = transport.CheckError(resp, http.StatusOK, http.StatusUnauthorized)
+	if err != nil {
+		return fmt.Errorf("failed to check health of registry %s: %w", reg, err)
+	}
+
+	return nil
+}
+
+// Warmup sends a manifest HEAD request for one reference of each distinct repository of refs,
+// concurrently, so that the token exchanges and the TCP/TLS connections are done before the real
+// pulls: the authenticated transport of each repository is kept by the puller the Registry shares
+// between its calls, and reused by the following ones (except those given call options changing
+// the transport or the authentication). The returned error combines the errors of all the failed
+// requests.
+func (r *Registry) Warmup(ctx context.Context, refs []string) error {
+	seen := make(map[string]bool)
+
+	var (
+		mu    sync.Mutex
+		errs  []error
+		group errgroup.Group
+	)
+
+	group.SetLimit(defaultConcurrency)
+
+	for _, imageRef := range refs {
+		ref, err := r.parseReference(imageRef)
+		if err != nil {
+			mu.Lock()
+			errs = append(errs, fmt.Errorf("failed to parse image reference %s: %w", imageRef, err))
+			mu.Unlock()
+
+			continue
+		}
+
+		if seen[ref.Context().String()] {
+			continue
+		}
+
+		seen[ref.Context().String()] = true
+
+		group.Go(func() error {
+			callCtx, cancel := r.boundedOperationContext(ctx)
+			defer cancel()
+
+			err := r.withAuthRefresh(func() error {
+				_, err := remote.Head(ref, append(r.remoteOptions(), remote.WithContext(callCtx))...)
+
+				return err
+			})
+			if err != nil {
+				mu.Lock()
+				defer mu.Unlock()
+
+				errs = append(errs, fmt.Errorf("failed to warm up repository %s: %w", ref.Context(), err))
+			}
+
+			return nil
+		})
+	}
+
+	_ = group.Wait()
+
+	return errors.Join(errs...)
+}
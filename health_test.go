@@ -0,0 +1,91 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// operationStartTransport is an http.RoundTripper recording whether the manifest requests are
+// sent with the operation start time set by operationContext.
+type operationStartTransport struct {
+	withStart atomic.Int32
+	inner     http.RoundTripper
+}
+
+func (t *operationStartTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if _, ok := req.Context().Value(operationStartKey{}).(time.Time); ok && strings.Contains(req.URL.Path, "/manifests/") {
+		t.withStart.Add(1)
+	}
+
+	return t.inner.RoundTrip(req)
+}
+
+func TestWarmupKeepsOperationContext(t *testing.T) {
+	t.Parallel()
+
+	host := startTestRegistry(t, nil)
+
+	ref, err := name.ParseReference(host + "/test/app:latest")
+	if err != nil {
+		t.Fatalf("name.ParseReference() error = %v", err)
+	}
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() error = %v", err)
+	}
+
+	err = remote.Write(ref, img)
+	if err != nil {
+		t.Fatalf("remote.Write() error = %v", err)
+	}
+
+	rt := &operationStartTransport{inner: http.DefaultTransport}
+
+	r, err := New(host, WithReadTransport(rt), WithOperationDeadline(time.Minute))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	err = r.Warmup(context.Background(), []string{ref.String()})
+	if err != nil {
+		t.Fatalf("Warmup() error = %v", err)
+	}
+
+	if rt.withStart.Load() == 0 {
+		t.Error("Warmup() requests lack the operation start time bounding them with the operation deadline")
+	}
+
+	// Canceling either the context of the Registry or the one given to Warmup stops it.
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	r, err = New(host, WithContext(canceled))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	err = r.Warmup(context.Background(), []string{ref.String()})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Warmup() error = %v with a canceled Registry context, want %v", err, context.Canceled)
+	}
+
+	r, err = New(host)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	err = r.Warmup(canceled, []string{ref.String()})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Warmup() error = %v with a canceled context, want %v", err, context.Canceled)
+	}
+}
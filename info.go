@@ -0,0 +1,140 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+const (
+	// ghcrHost is the host of the GitHub container registry.
+	ghcrHost = "ghcr.io"
+	// harborSystemInfoPath is the path of the system information endpoint of the Harbor API.
+	harborSystemInfoPath = "/api/v2.0/systeminfo"
+)
+
+// RegistryInfo holds the product and the capabilities of a registry, as reported by RegistryInfo.
+type RegistryInfo struct {
+	// Product is the name of the registry product, like "harbor", "ghcr" or the product advertised
+	// by the Server header (e.g. "artifactory").
+	Product string
+	// Version is the version of the registry product.
+	Version string
+	// DeleteEnabled is true when manifests can be deleted through the registry API.
+	DeleteEnabled bool
+	// ImmutabilitySupported is true when the registry supports immutable tags.
+	ImmutabilitySupported bool
+	// UnknownFields lists the names of the fields above that couldn't be determined, and are
+	// left to their zero value.
+	UnknownFields []string
+}
+
+// harborSystemInfo is the part of the response of the Harbor system information endpoint used to
+// recognize Harbor. The version is only returned to authenticated users.
+type harborSystemInfo struct {
+	AuthMode      string `json:"auth_mode"`
+	HarborVersion string `json:"harbor_version"`
+}
+
+// RegistryInfo returns the product and the capabilities of the registry. They are known for the
+// recognized registries: GHCR by its host and Harbor by its system information endpoint. For the
+// other registries, only the product and version advertised by the Server header of the /v2/
+// endpoint are returned, and the undetermined fields are listed in UnknownFields.
+func (r *Registry) RegistryInfo() (*RegistryInfo, error) {
+	reg, err := r.registry()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse registry %s: %w", r.URL, err)
+	}
+
+	resp, err := r.getEndpoint(reg, "/v2/")
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach registry %s: %w", reg, err)
+	}
+	resp.Body.Close()
+
+	var (
+		info         RegistryInfo
+		capabilities bool
+	)
+
+	info.Product, info.Version, _ = strings.Cut(resp.Header.Get("Server"), "/")
+	info.Product = strings.ToLower(strings.TrimSpace(info.Product))
+	info.Version, _, _ = strings.Cut(info.Version, " ")
+
+	if reg.RegistryStr() == ghcrHost {
+		// GHCR deletes packages through the GitHub API only, and has no immutable tags.
+		info = RegistryInfo{Product: "ghcr"}
+		capabilities = true
+	} else if harbor, ok := r.harborSystemInfo(reg); ok {
+		info = RegistryInfo{
+			Product:               "harbor",
+			Version:               harbor.HarborVersion,
+			DeleteEnabled:         true,
+			ImmutabilitySupported: true,
+		}
+		capabilities = true
+	}
+
+	if info.Product == "" {
+		info.UnknownFields = append(info.UnknownFields, "Product")
+	}
+
+	if info.Version == "" {
+		info.UnknownFields = append(info.UnknownFields, "Version")
+	}
+
+	if !capabilities {
+		info.UnknownFields = append(info.UnknownFields, "DeleteEnabled", "ImmutabilitySupported")
+	}
+
+	return &info, nil
+}
+
+// harborSystemInfo queries the Harbor system information endpoint of the registry, and reports
+// whether it responded like Harbor does.
+func (r *Registry) harborSystemInfo(reg name.Registry) (harborSystemInfo, bool) {
+	var info harborSystemInfo
+
+	resp, err := r.getEndpoint(reg, harborSystemInfoPath)
+	if err != nil {
+		return info, false
+	}
+	defer resp.Body.Close()
+
+	if transport.CheckError(resp, http.StatusOK) != nil {
+		return info, false
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&info)
+
+	return info, err == nil && info.AuthMode != ""
+}
+
+// getEndpoint sends an unauthenticated GET request to the given path of the registry. The caller
+// closes the body of the response.
+func (r *Registry) getEndpoint(reg name.Registry, path string) (*http.Response, error) {
+	uri := url.URL{
+		Scheme: reg.Scheme(),
+		Host:   reg.RegistryStr(),
+		Path:   path,
+	}
+
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, uri.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	client := http.Client{Transport: r.transport(callOptions{})}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	return resp, nil
+}
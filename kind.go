@@ -0,0 +1,85 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// Kind is the kind of manifest a reference points to.
+type Kind string
+
+const (
+	// KindImage is a single-platform image manifest (docker schema2 or OCI).
+	KindImage Kind = "image"
+	// KindIndex is a multi-platform index (docker manifest list or OCI index).
+	KindIndex Kind = "index"
+	// KindSchema1 is a deprecated docker schema1 manifest.
+	KindSchema1 Kind = "schema1"
+	// KindUnknown is a manifest of any other media type.
+	KindUnknown Kind = "unknown"
+)
+
+// ErrSchema1Unsupported is returned, wrapped in a Schema1Error, when an image is a deprecated
+// docker schema1 manifest and the Registry isn't created WithSchema1Conversion.
+var ErrSchema1Unsupported = errors.New("docker schema1 manifests are not supported")
+
+// Schema1Error is returned when an image is a deprecated docker schema1 manifest.
+type Schema1Error struct {
+	// MediaType is the media type of the manifest, signed or not.
+	MediaType types.MediaType
+	// Raw is the raw schema1 manifest.
+	Raw []byte
+}
+
+// Error implements error.
+func (e *Schema1Error) Error() string {
+	return fmt.Sprintf("manifest of media type %s: %s", e.MediaType, ErrSchema1Unsupported)
+}
+
+// Unwrap returns ErrSchema1Unsupported.
+func (e *Schema1Error) Unwrap() error {
+	return ErrSchema1Unsupported
+}
+
+// Kind returns the kind of manifest the given image ref points to.
+func (r *Registry) Kind(imageRef string) (Kind, error) {
+	ref, err := r.parseReference(imageRef)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse image reference %s: %w", imageRef, err)
+	}
+
+	var desc *remote.Descriptor
+
+	err = r.withAuthRefresh(func() error {
+		desc, err = remote.Get(ref, r.remoteOptions()...)
+
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get manifest from remote for image %s: %w", imageRef, err)
+	}
+
+	return manifestKind(desc.MediaType), nil
+}
+
+// manifestKind returns the kind of manifest of the given media type.
+func manifestKind(mediaType types.MediaType) Kind {
+	switch {
+	case isSchema1(mediaType):
+		return KindSchema1
+	case mediaType.IsIndex():
+		return KindIndex
+	case mediaType.IsImage():
+		return KindImage
+	default:
+		return KindUnknown
+	}
+}
+
+// isSchema1 reports whether the given media type is a docker schema1 manifest.
+func isSchema1(mediaType types.MediaType) bool {
+	return mediaType == types.DockerManifestSchema1 || mediaType == types.DockerManifestSchema1Signed
+}
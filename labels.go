@@ -0,0 +1,114 @@
+package registry
+
+import (
+	"fmt"
+	"maps"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// SetLabels merges the given labels into the config labels of the given image (of all its images
+// for an index), pushes the result under the same tag, and returns its new digest.
+//
+// Since the config changes, the digest of the image changes: when imageRef is a digest reference,
+// the result is pushed under its new digest only. The attestation manifests of an index (see
+// Attestations) describe the images before relabeling, so they are dropped rather than relabeled.
+func (r *Registry) SetLabels(imageRef string, labels map[string]string) (string, error) {
+	digest, err := r.setLabels(imageRef, labels)
+	r.emit("SetLabels", imageRef, digest, err)
+
+	if err != nil {
+		return "", err
+	}
+
+	return digest.String(), nil
+}
+
+// setLabels implements SetLabels.
+func (r *Registry) setLabels(imageRef string, labels map[string]string) (v1.Hash, error) {
+	ref, err := r.parseReference(imageRef)
+	if err != nil {
+		return v1.Hash{}, fmt.Errorf("failed to parse image reference %s: %w", imageRef, err)
+	}
+
+	var digest v1.Hash
+
+	err = r.withAuthRefresh(func() error {
+		desc, err := remote.Get(ref, r.remoteOptions()...)
+		if err != nil {
+			return fmt.Errorf("failed to get manifest: %w", err)
+		}
+
+		labelImage := func(img v1.Image) (v1.Image, error) {
+			return setImageLabels(img, labels)
+		}
+
+		if desc.MediaType.IsIndex() {
+			idx, err := desc.ImageIndex()
+			if err != nil {
+				return fmt.Errorf("failed to get index: %w", err)
+			}
+
+			idx = mutate.RemoveManifests(idx, isAttestation)
+
+			idx, err = transformIndex(idx, func(mt types.MediaType) types.MediaType { return mt }, labelImage)
+			if err != nil {
+				return err
+			}
+
+			digest, err = idx.Digest()
+			if err != nil {
+				return fmt.Errorf("failed to compute index digest: %w", err)
+			}
+
+			return remote.WriteIndex(destinationOf(ref, digest), idx, r.remoteOptions(withWrite())...)
+		}
+
+		img, err := desc.Image()
+		if err != nil {
+			return fmt.Errorf("failed to get image: %w", err)
+		}
+
+		img, err = labelImage(img)
+		if err != nil {
+			return err
+		}
+
+		digest, err = img.Digest()
+		if err != nil {
+			return fmt.Errorf("failed to compute image digest: %w", err)
+		}
+
+		return remote.Write(destinationOf(ref, digest), img, r.remoteOptions(withWrite())...)
+	})
+	if err != nil {
+		return v1.Hash{}, fmt.Errorf("failed to set labels on image %s: %w", imageRef, err)
+	}
+
+	return digest, r.verifyWrite(destinationOf(ref, digest), digest)
+}
+
+// setImageLabels merges the given labels into the config labels of the image.
+func setImageLabels(img v1.Image, labels map[string]string) (v1.Image, error) {
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config: %w", err)
+	}
+
+	config := *cfg.Config.DeepCopy()
+	if config.Labels == nil {
+		config.Labels = make(map[string]string, len(labels))
+	}
+
+	maps.Copy(config.Labels, labels)
+
+	img, err = mutate.Config(img, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set config: %w", err)
+	}
+
+	return img, nil
+}
@@ -0,0 +1,62 @@
+package registry
+
+import (
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+func TestSetLabelsDropsAttestations(t *testing.T) {
+	t.Parallel()
+
+	host := startTestRegistry(t, nil)
+
+	ref, err := name.ParseReference(host + "/test/app:latest")
+	if err != nil {
+		t.Fatalf("name.ParseReference() error = %v", err)
+	}
+
+	err = remote.WriteIndex(ref, newAttestedIndex(t))
+	if err != nil {
+		t.Fatalf("remote.WriteIndex() error = %v", err)
+	}
+
+	r, err := New(host)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	_, err = r.SetLabels(ref.String(), map[string]string{"team": "platform"})
+	if err != nil {
+		t.Fatalf("SetLabels() error = %v", err)
+	}
+
+	idx, err := remote.Index(ref)
+	if err != nil {
+		t.Fatalf("remote.Index() error = %v", err)
+	}
+
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		t.Fatalf("idx.IndexManifest() error = %v", err)
+	}
+
+	if len(manifest.Manifests) != 1 || isAttestation(manifest.Manifests[0]) {
+		t.Fatalf("SetLabels() index manifests = %+v, want the relabeled image only", manifest.Manifests)
+	}
+
+	img, err := idx.Image(manifest.Manifests[0].Digest)
+	if err != nil {
+		t.Fatalf("idx.Image() error = %v", err)
+	}
+
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		t.Fatalf("img.ConfigFile() error = %v", err)
+	}
+
+	if got := cfg.Config.Labels["team"]; got != "platform" {
+		t.Errorf("SetLabels() label team = %q, want %q", got, "platform")
+	}
+}
@@ -0,0 +1,405 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"golang.org/x/sync/errgroup"
+)
+
+// ErrBlobNotFound is returned by VerifyLayers for each blob missing from the repository.
+var ErrBlobNotFound = errors.New("blob not found")
+
+// LayerReader returns a stream of the compressed content of the given layer of an image.
+// The caller is responsible for closing it.
+func (r *Registry) LayerReader(imageRef string, layerDigest v1.Hash) (io.ReadCloser, error) {
+	ref, err := r.parseReference(imageRef)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse image reference %s: %w", imageRef, err)
+	}
+
+	var rc io.ReadCloser
+
+	err = r.withAuthRefresh(func() error {
+		layer, err := remote.Layer(ref.Context().Digest(layerDigest.String()), r.remoteOptions(withLayerStreaming())...)
+		if err != nil {
+			return err
+		}
+
+		rc, err = layer.Compressed()
+
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read layer %s from remote for image %s: %w", layerDigest, imageRef, err)
+	}
+
+	return rc, nil
+}
+
+// CanMount reports whether the given blob exists in the repository fromRepo, so it can be mounted
+// from there into another repository of the same registry instead of being uploaded.
+func (r *Registry) CanMount(layerDigest v1.Hash, fromRepo string) (bool, error) {
+	repo, err := r.newRepository(fromRepo)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse repository %s: %w", fromRepo, err)
+	}
+
+	exists, err := r.blobExists(r.newSharedRepositoryClient(repo, transport.PullScope), layerDigest)
+	if err != nil {
+		return false, fmt.Errorf("failed to get blob %s head from remote for repository %s: %w", layerDigest, fromRepo, err)
+	}
+
+	return exists, nil
+}
+
+// BlobsExist reports, for each of the given blob digests, whether the blob exists in the
+// repository, checking them concurrently. If some blobs can't be checked, the map of the blobs
+// that were checked is returned along with an error combining every failure.
+func (r *Registry) BlobsExist(repository string, digests []v1.Hash) (map[v1.Hash]bool, error) {
+	repo, err := r.newRepository(repository)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse repository %s: %w", repository, err)
+	}
+
+	var (
+		client = r.newSharedRepositoryClient(repo, transport.PullScope)
+		mu     sync.Mutex
+		exists = make(map[v1.Hash]bool, len(digests))
+		errs   []error
+		group  errgroup.Group
+	)
+
+	group.SetLimit(defaultConcurrency)
+
+	for _, digest := range digests {
+		group.Go(func() error {
+			found, err := r.blobExists(client, digest)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to get blob %s head: %w", digest, err))
+			} else {
+				exists[digest] = found
+			}
+
+			return nil
+		})
+	}
+
+	_ = group.Wait()
+
+	if len(errs) > 0 {
+		return exists, fmt.Errorf("failed to check %d blobs of repository %s: %w",
+			len(errs), repository, errors.Join(errs...))
+	}
+
+	return exists, nil
+}
+
+// blobExists reports whether the given blob exists in the repository of the given client.
+func (r *Registry) blobExists(repo *sharedRepositoryClient, digest v1.Hash) (bool, error) {
+	var exists bool
+
+	err := repo.do(func(client *http.Client) error {
+		uri := url.URL{
+			Scheme: repo.repo.Scheme(),
+			Host:   repo.repo.RegistryStr(),
+			Path:   fmt.Sprintf("/v2/%s/blobs/%s", repo.repo.RepositoryStr(), digest),
+		}
+
+		req, err := http.NewRequestWithContext(r.ctx, http.MethodHead, uri.String(), nil)
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("failed to send request: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode == http.StatusNotFound {
+			exists = false
+
+			return nil
+		}
+
+		err = transport.CheckError(resp, http.StatusOK)
+		exists = err == nil
+
+		return err
+	})
+
+	return exists, err
+}
+
+// UploadSize returns the number of bytes that would need to be uploaded to mirror the given image
+// (with all its platforms for an index) to the repository dstRepo of the dst Registry: it is the
+// sum of the sizes of the config and layer blobs which are not already present in dstRepo.
+// Non-distributable layers, which are never pushed, are not counted.
+func (r *Registry) UploadSize(srcRef string, dst *Registry, dstRepo string) (int64, error) {
+	ref, err := r.parseReference(srcRef)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse image reference %s: %w", srcRef, err)
+	}
+
+	repo, err := dst.newRepository(dstRepo)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse repository %s: %w", dstRepo, err)
+	}
+
+	var configs, layers []v1.Descriptor
+
+	err = r.withAuthRefresh(func() error {
+		configs, layers, err = r.imageBlobs(ref)
+
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get blobs from remote for image %s: %w", srcRef, err)
+	}
+
+	var (
+		client = dst.newSharedRepositoryClient(repo, transport.PullScope)
+		mu     sync.Mutex
+		size   int64
+		group  errgroup.Group
+	)
+
+	group.SetLimit(defaultConcurrency)
+
+	for _, blob := range append(configs, layers...) {
+		if !blob.MediaType.IsDistributable() {
+			continue
+		}
+
+		group.Go(func() error {
+			exists, err := dst.blobExists(client, blob.Digest)
+			if err != nil {
+				return fmt.Errorf("failed to get blob %s head from remote for repository %s: %w", blob.Digest, dstRepo, err)
+			}
+
+			if !exists {
+				mu.Lock()
+				defer mu.Unlock()
+
+				size += blob.Size
+			}
+
+			return nil
+		})
+	}
+
+	err = group.Wait()
+	if err != nil {
+		return 0, err
+	}
+
+	return size, nil
+}
+
+// VerifyLayers checks that the config and layer blobs referenced by the given image (by all its
+// images for an index) are present in its repository. The returned error combines the errors of
+// all the missing (ErrBlobNotFound) or inaccessible blobs. Non-distributable layers are skipped.
+func (r *Registry) VerifyLayers(imageRef string) error {
+	ref, err := r.parseReference(imageRef)
+	if err != nil {
+		return fmt.Errorf("failed to parse image reference %s: %w", imageRef, err)
+	}
+
+	var configs, layers []v1.Descriptor
+
+	err = r.withAuthRefresh(func() error {
+		configs, layers, err = r.imageBlobs(ref)
+
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get blobs from remote for image %s: %w", imageRef, err)
+	}
+
+	var (
+		client = r.newSharedRepositoryClient(ref.Context(), transport.PullScope)
+		mu     sync.Mutex
+		errs   []error
+		group  errgroup.Group
+	)
+
+	group.SetLimit(defaultConcurrency)
+
+	for _, blob := range append(configs, layers...) {
+		if !blob.MediaType.IsDistributable() {
+			continue
+		}
+
+		group.Go(func() error {
+			exists, err := r.blobExists(client, blob.Digest)
+			if err == nil && !exists {
+				err = ErrBlobNotFound
+			}
+
+			if err != nil {
+				mu.Lock()
+				defer mu.Unlock()
+
+				errs = append(errs, fmt.Errorf("failed to verify blob %s: %w", blob.Digest, err))
+			}
+
+			return nil
+		})
+	}
+
+	_ = group.Wait()
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to verify %d blobs of image %s: %w", len(errs), imageRef, errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// ForeignLayerURLs returns the URLs the non-distributable layers of the given image (of all its
+// images for an index), like the base layers of Windows images, are downloaded from, as listed
+// in its manifest, without duplicates.
+func (r *Registry) ForeignLayerURLs(imageRef string) ([]string, error) {
+	ref, err := r.parseReference(imageRef)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse image reference %s: %w", imageRef, err)
+	}
+
+	var layers []v1.Descriptor
+
+	err = r.withAuthRefresh(func() error {
+		_, layers, err = r.imageBlobs(ref)
+
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get layers from remote for image %s: %w", imageRef, err)
+	}
+
+	var urls []string
+
+	for _, layer := range layers {
+		if layer.MediaType.IsDistributable() {
+			continue
+		}
+
+		for _, layerURL := range layer.URLs {
+			if !slices.Contains(urls, layerURL) {
+				urls = append(urls, layerURL)
+			}
+		}
+	}
+
+	return urls, nil
+}
+
+// imageBlobs returns the descriptors of the config and layer blobs referenced by the given image,
+// or by all the images of the given index, without duplicates.
+func (r *Registry) imageBlobs(ref name.Reference, opts ...CallOption) ([]v1.Descriptor, []v1.Descriptor, error) {
+	desc, err := remote.Get(ref, r.remoteOptions(opts...)...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get manifest: %w", err)
+	}
+
+	var (
+		configs, layers []v1.Descriptor
+		seen            = make(map[v1.Hash]bool)
+	)
+
+	addImage := func(img v1.Image) error {
+		manifest, err := img.Manifest()
+		if err != nil {
+			return fmt.Errorf("failed to get manifest: %w", err)
+		}
+
+		if !seen[manifest.Config.Digest] {
+			seen[manifest.Config.Digest] = true
+			configs = append(configs, manifest.Config)
+		}
+
+		for _, layer := range manifest.Layers {
+			if !seen[layer.Digest] {
+				seen[layer.Digest] = true
+				layers = append(layers, layer)
+			}
+		}
+
+		return nil
+	}
+
+	if !desc.MediaType.IsIndex() {
+		img, err := desc.Image()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get image: %w", err)
+		}
+
+		err = addImage(img)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return configs, layers, nil
+	}
+
+	idx, err := desc.ImageIndex()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get index: %w", err)
+	}
+
+	err = walkIndexImages(idx, addImage)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return configs, layers, nil
+}
+
+// walkIndexImages calls fn for each image of the given index, recursing into nested indexes.
+// Children which are neither images nor indexes are skipped.
+func walkIndexImages(idx v1.ImageIndex, fn func(v1.Image) error) error {
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		return fmt.Errorf("failed to get index manifest: %w", err)
+	}
+
+	for _, child := range manifest.Manifests {
+		switch {
+		case child.MediaType.IsIndex():
+			childIdx, err := idx.ImageIndex(child.Digest)
+			if err != nil {
+				return fmt.Errorf("failed to get index %s: %w", child.Digest, err)
+			}
+
+			err = walkIndexImages(childIdx, fn)
+			if err != nil {
+				return err
+			}
+		case child.MediaType.IsImage():
+			img, err := idx.Image(child.Digest)
+			if err != nil {
+				return fmt.Errorf("failed to get image %s: %w", child.Digest, err)
+			}
+
+			err = fn(img)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package registry
+
+import (
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+func TestUploadSize(t *testing.T) {
+	t.Parallel()
+
+	srcHost := startTestRegistry(t, nil)
+	dstHost := startTestRegistry(t, nil)
+
+	img, err := random.Image(1024, 3)
+	if err != nil {
+		t.Fatalf("random.Image() error = %v", err)
+	}
+
+	manifest, err := img.Manifest()
+	if err != nil {
+		t.Fatalf("img.Manifest() error = %v", err)
+	}
+
+	want := manifest.Config.Size
+	for _, layer := range manifest.Layers {
+		want += layer.Size
+	}
+
+	src, err := name.ParseReference(srcHost + "/test/app:1")
+	if err != nil {
+		t.Fatalf("name.ParseReference() error = %v", err)
+	}
+
+	err = remote.Write(src, img)
+	if err != nil {
+		t.Fatalf("remote.Write() error = %v", err)
+	}
+
+	r, err := New(srcHost)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	dst, err := New(dstHost)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	got, err := r.UploadSize(src.String(), dst, dstHost+"/test/app")
+	if err != nil {
+		t.Fatalf("UploadSize() error = %v", err)
+	}
+
+	if got != want {
+		t.Errorf("UploadSize() = %d, want the size of the config and layers %d", got, want)
+	}
+
+	dstRef, err := name.ParseReference(dstHost + "/test/app:1")
+	if err != nil {
+		t.Fatalf("name.ParseReference() error = %v", err)
+	}
+
+	err = remote.Write(dstRef, img)
+	if err != nil {
+		t.Fatalf("remote.Write() error = %v", err)
+	}
+
+	got, err = r.UploadSize(src.String(), dst, dstHost+"/test/app")
+	if err != nil {
+		t.Fatalf("UploadSize() error = %v", err)
+	}
+
+	if got != 0 {
+		t.Errorf("UploadSize() = %d once mirrored, want 0", got)
+	}
+}
@@ -0,0 +1,150 @@
+package registry
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/match"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"golang.org/x/sync/errgroup"
+)
+
+// annotationRefName is the OCI annotation holding the reference of an image in a layout index.
+const annotationRefName = "org.opencontainers.image.ref.name"
+
+// PullIncremental pulls the given image or index into the existing OCI layout at layoutPath,
+// downloading only the blobs missing from the layout, then references it in the layout index
+// (annotated with its expanded reference name, like index.docker.io/library/alpine:latest) in
+// place of the image previously pulled from the same reference.
+func (r *Registry) PullIncremental(imageRef, layoutPath string) error {
+	ref, err := r.parseReference(imageRef)
+	if err != nil {
+		return fmt.Errorf("failed to parse image reference %s: %w", imageRef, err)
+	}
+
+	path, err := layout.FromPath(layoutPath)
+	if err != nil {
+		return fmt.Errorf("failed to open layout %s: %w", layoutPath, err)
+	}
+
+	var (
+		desc      *remote.Descriptor
+		manifests []rawManifest
+		blobs     = make(map[v1.Hash]v1.Descriptor)
+	)
+
+	err = r.withAuthRefresh(func() error {
+		desc, err = remote.Get(ref, r.remoteOptions()...)
+		if err != nil {
+			return err
+		}
+
+		if desc.MediaType.IsIndex() {
+			idx, err := desc.ImageIndex()
+			if err != nil {
+				return err
+			}
+
+			manifests, err = collectIndexManifests(idx, manifests, blobs)
+
+			return err
+		}
+
+		img, err := desc.Image()
+		if err != nil {
+			return err
+		}
+
+		return collectImageBlobs(img, blobs)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get manifest from remote for image %s: %w", imageRef, err)
+	}
+
+	var group errgroup.Group
+
+	group.SetLimit(defaultConcurrency)
+
+	for digest, blob := range blobs {
+		if !blob.MediaType.IsDistributable() {
+			continue
+		}
+
+		group.Go(func() error {
+			return r.pullMissingBlob(path, ref.Context().Digest(digest.String()), digest)
+		})
+	}
+
+	err = group.Wait()
+	if err != nil {
+		return fmt.Errorf("failed to pull blobs of image %s: %w", imageRef, err)
+	}
+
+	manifests = append(manifests, rawManifest{digest: desc.Digest, mediaType: desc.MediaType, raw: desc.Manifest})
+	for _, manifest := range manifests {
+		err = path.WriteBlob(manifest.digest, io.NopCloser(bytes.NewReader(manifest.raw)))
+		if err != nil {
+			return fmt.Errorf("failed to write manifest %s to layout %s: %w", manifest.digest, layoutPath, err)
+		}
+	}
+
+	err = path.RemoveDescriptors(match.Annotation(annotationRefName, ref.Name()))
+	if err != nil {
+		return fmt.Errorf("failed to update index of layout %s: %w", layoutPath, err)
+	}
+
+	err = path.AppendDescriptor(v1.Descriptor{
+		MediaType:   desc.MediaType,
+		Size:        desc.Size,
+		Digest:      desc.Digest,
+		Annotations: map[string]string{annotationRefName: ref.Name()},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update index of layout %s: %w", layoutPath, err)
+	}
+
+	return nil
+}
+
+// pullMissingBlob downloads the given blob into the layout, unless it is already there.
+// A partially downloaded blob is removed, so it isn't considered present by the next pull.
+func (r *Registry) pullMissingBlob(path layout.Path, ref name.Digest, digest v1.Hash) error {
+	rc, err := path.Blob(digest)
+	if err == nil {
+		return rc.Close() //nolint:wrapcheck
+	}
+
+	if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to read blob %s: %w", digest, err)
+	}
+
+	err = r.withAuthRefresh(func() error {
+		layer, err := remote.Layer(ref, r.remoteOptions(withLayerStreaming())...)
+		if err != nil {
+			return err
+		}
+
+		rc, err := layer.Compressed()
+		if err != nil {
+			return err
+		}
+
+		err = path.WriteBlob(digest, rc)
+		if err != nil {
+			return errors.Join(err, path.RemoveBlob(digest))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to pull blob %s: %w", digest, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"golang.org/x/sync/errgroup"
+)
+
+// ResolveAll resolves concurrently each of the given references to the digest reference it
+// currently points to, keyed by the given reference, e.g. to generate a lock file. If some
+// references fail to resolve, the map of the references that were resolved is returned along
+// with an error combining every failure.
+func (r *Registry) ResolveAll(refs []string) (map[string]name.Digest, error) {
+	var (
+		mu       sync.Mutex
+		resolved = make(map[string]name.Digest, len(refs))
+		errs     []error
+		group    errgroup.Group
+	)
+
+	group.SetLimit(defaultConcurrency)
+
+	for _, imageRef := range refs {
+		group.Go(func() error {
+			digest, err := r.resolve(imageRef)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				errs = append(errs, err)
+			} else {
+				resolved[imageRef] = digest
+			}
+
+			return nil
+		})
+	}
+
+	_ = group.Wait()
+
+	if len(errs) > 0 {
+		return resolved, fmt.Errorf("failed to resolve %d of %d references: %w", len(errs), len(refs), errors.Join(errs...))
+	}
+
+	return resolved, nil
+}
+
+// VerifyLock resolves the references of the given lock, mapping references to their locked digest
+// (like "sha256:..." or a digest reference as returned by ResolveAll), and returns the sorted
+// references which now point to another digest. The locked digests are normalized with
+// NormalizeDigest. If some entries have an invalid digest (ErrInvalidDigest) or can't be resolved,
+// the drift of the other entries is returned along with an error combining every failure.
+func (r *Registry) VerifyLock(lock map[string]string) ([]string, error) {
+	var (
+		refs   = make([]string, 0, len(lock))
+		locked = make(map[string]string, len(lock))
+		errs   []error
+	)
+
+	for imageRef, lockedRef := range lock {
+		if _, digest, ok := strings.Cut(lockedRef, "@"); ok {
+			lockedRef = digest
+		}
+
+		digest, err := NormalizeDigest(lockedRef)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to read locked digest of %s: %w", imageRef, err))
+
+			continue
+		}
+
+		refs = append(refs, imageRef)
+		locked[imageRef] = digest
+	}
+
+	resolved, err := r.ResolveAll(refs)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	var drifted []string
+
+	for imageRef, digest := range locked {
+		current, ok := resolved[imageRef]
+		if ok && current.DigestStr() != digest {
+			drifted = append(drifted, imageRef)
+		}
+	}
+
+	slices.Sort(drifted)
+
+	return drifted, errors.Join(errs...)
+}
+
+// resolve returns the digest reference the given image ref currently points to.
+func (r *Registry) resolve(imageRef string) (name.Digest, error) {
+	ref, err := r.parseReference(imageRef)
+	if err != nil {
+		return name.Digest{}, fmt.Errorf("failed to parse image reference %s: %w", imageRef, err)
+	}
+
+	var digest name.Digest
+
+	err = r.withAuthRefresh(func() error {
+		head, err := remote.Head(ref, r.remoteOptions()...)
+		if err != nil {
+			return err
+		}
+
+		digest = ref.Context().Digest(head.Digest.String())
+
+		return nil
+	})
+	if err != nil {
+		return name.Digest{}, fmt.Errorf("failed to get head from remote for image %s: %w", imageRef, err)
+	}
+
+	return digest, nil
+}
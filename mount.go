@@ -0,0 +1,318 @@
+package registry
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"golang.org/x/sync/errgroup"
+)
+
+// errMountRejected is returned when the registry doesn't mount a blob from another repository.
+var errMountRejected = errors.New("blob mount rejected")
+
+// rawManifest is a manifest to put as is in a repository.
+type rawManifest struct {
+	digest    v1.Hash
+	mediaType types.MediaType
+	raw       []byte
+}
+
+// CopyWithin copies the image or index tagged tag from the repository srcRepo to the repository
+// dstRepo of the same registry, by mounting its blobs from srcRepo and putting its manifests, so
+// no blob content is downloaded nor uploaded.
+//
+// When the repositories are on different registries, or when the registry refuses to mount the
+// blobs, it falls back to a regular Copy.
+func (r *Registry) CopyWithin(srcRepo, dstRepo, tag string) error {
+	digest, err := r.copyWithin(srcRepo, dstRepo, tag)
+	r.emit("CopyWithin", dstRepo+":"+tag, digest, err)
+
+	return err
+}
+
+// copyWithin implements CopyWithin, returning the digest of the copied manifest.
+func (r *Registry) copyWithin(srcRepo, dstRepo, tag string) (v1.Hash, error) {
+	src, err := r.newRepository(srcRepo)
+	if err != nil {
+		return v1.Hash{}, fmt.Errorf("failed to parse repository %s: %w", srcRepo, err)
+	}
+
+	dst, err := r.newRepository(dstRepo)
+	if err != nil {
+		return v1.Hash{}, fmt.Errorf("failed to parse repository %s: %w", dstRepo, err)
+	}
+
+	if src.Registry != dst.Registry {
+		pushed, err := r.copyRef(src.Tag(tag).String(), dst.Tag(tag).String())
+
+		return descriptorDigest(pushed), err
+	}
+
+	var digest v1.Hash
+
+	err = r.withAuthRefresh(func() error {
+		digest, err = r.mountTag(src, dst, tag)
+
+		return err
+	})
+	if errors.Is(err, errMountRejected) {
+		pushed, err := r.copyRef(src.Tag(tag).String(), dst.Tag(tag).String())
+
+		return descriptorDigest(pushed), err
+	}
+
+	if err != nil {
+		return v1.Hash{}, fmt.Errorf("failed to copy %s:%s to %s: %w", srcRepo, tag, dstRepo, err)
+	}
+
+	return digest, nil
+}
+
+// mountTag mounts the blobs of the given tag of src into dst, then puts its manifests in dst.
+// It returns the digest of the tagged manifest.
+func (r *Registry) mountTag(src, dst name.Repository, tag string) (v1.Hash, error) {
+	desc, err := remote.Get(src.Tag(tag), r.remoteOptions()...)
+	if err != nil {
+		return v1.Hash{}, fmt.Errorf("failed to get manifest: %w", err)
+	}
+
+	var (
+		manifests []rawManifest
+		blobs     = make(map[v1.Hash]v1.Descriptor)
+	)
+
+	if desc.MediaType.IsIndex() {
+		idx, err := desc.ImageIndex()
+		if err != nil {
+			return v1.Hash{}, fmt.Errorf("failed to get index: %w", err)
+		}
+
+		manifests, err = collectIndexManifests(idx, manifests, blobs)
+		if err != nil {
+			return v1.Hash{}, err
+		}
+	} else {
+		img, err := desc.Image()
+		if err != nil {
+			return v1.Hash{}, fmt.Errorf("failed to get image: %w", err)
+		}
+
+		err = collectImageBlobs(img, blobs)
+		if err != nil {
+			return v1.Hash{}, err
+		}
+	}
+
+	auth, err := r.targetAuthenticator(dst.Registry)
+	if err != nil {
+		return v1.Hash{}, err
+	}
+
+	rt, err := transport.NewWithContext(r.ctx, dst.Registry, auth, r.transport(callOptions{write: true}),
+		[]string{src.Scope(transport.PullScope), dst.Scope(transport.PushScope)})
+	if err != nil {
+		return v1.Hash{}, fmt.Errorf("failed to create transport for repository %s: %w", dst, err)
+	}
+
+	client := &http.Client{Transport: rt}
+
+	var group errgroup.Group
+
+	group.SetLimit(defaultConcurrency)
+
+	for digest, blob := range blobs {
+		if !blob.MediaType.IsDistributable() {
+			continue
+		}
+
+		group.Go(func() error {
+			return r.mountBlob(client, src, dst, digest)
+		})
+	}
+
+	err = group.Wait()
+	if err != nil {
+		return v1.Hash{}, err
+	}
+
+	for _, manifest := range manifests {
+		err = r.putManifest(client, dst, manifest.digest.String(), manifest.mediaType, manifest.raw)
+		if err != nil {
+			return v1.Hash{}, err
+		}
+	}
+
+	err = r.putManifest(client, dst, tag, desc.MediaType, desc.Manifest)
+	if err != nil {
+		return v1.Hash{}, err
+	}
+
+	err = r.verifyWrite(dst.Tag(tag), desc.Digest)
+	if err != nil {
+		return v1.Hash{}, err
+	}
+
+	return desc.Digest, nil
+}
+
+// collectIndexManifests appends the manifests of the children of the given index to manifests,
+// children of nested indexes first, and adds the blobs of its images to blobs.
+func collectIndexManifests(
+	idx v1.ImageIndex, manifests []rawManifest, blobs map[v1.Hash]v1.Descriptor,
+) ([]rawManifest, error) {
+	index, err := idx.IndexManifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get index manifest: %w", err)
+	}
+
+	for _, child := range index.Manifests {
+		var raw []byte
+
+		switch {
+		case child.MediaType.IsIndex():
+			childIdx, err := idx.ImageIndex(child.Digest)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get index %s: %w", child.Digest, err)
+			}
+
+			manifests, err = collectIndexManifests(childIdx, manifests, blobs)
+			if err != nil {
+				return nil, err
+			}
+
+			raw, err = childIdx.RawManifest()
+			if err != nil {
+				return nil, fmt.Errorf("failed to get manifest of index %s: %w", child.Digest, err)
+			}
+		default:
+			img, err := idx.Image(child.Digest)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get image %s: %w", child.Digest, err)
+			}
+
+			err = collectImageBlobs(img, blobs)
+			if err != nil {
+				return nil, err
+			}
+
+			raw, err = img.RawManifest()
+			if err != nil {
+				return nil, fmt.Errorf("failed to get manifest of image %s: %w", child.Digest, err)
+			}
+		}
+
+		manifests = append(manifests, rawManifest{digest: child.Digest, mediaType: child.MediaType, raw: raw})
+	}
+
+	return manifests, nil
+}
+
+// collectImageBlobs adds the config and layer blobs of the given image to blobs.
+func collectImageBlobs(img v1.Image, blobs map[v1.Hash]v1.Descriptor) error {
+	manifest, err := img.Manifest()
+	if err != nil {
+		return fmt.Errorf("failed to get manifest: %w", err)
+	}
+
+	blobs[manifest.Config.Digest] = manifest.Config
+	for _, layer := range manifest.Layers {
+		blobs[layer.Digest] = layer
+	}
+
+	return nil
+}
+
+// mountBlob mounts the given blob of src into dst. It fails with errMountRejected when the
+// registry starts a regular upload instead, after canceling that upload.
+func (r *Registry) mountBlob(client *http.Client, src, dst name.Repository, digest v1.Hash) error {
+	uri := url.URL{
+		Scheme:   dst.Scheme(),
+		Host:     dst.RegistryStr(),
+		Path:     fmt.Sprintf("/v2/%s/blobs/uploads/", dst.RepositoryStr()),
+		RawQuery: url.Values{"mount": {digest.String()}, "from": {src.RepositoryStr()}}.Encode(),
+	}
+
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodPost, uri.String(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusAccepted {
+		r.cancelUpload(client, resp)
+
+		return fmt.Errorf("failed to mount blob %s from %s: %w", digest, src, errMountRejected)
+	}
+
+	err = transport.CheckError(resp, http.StatusCreated)
+	if err != nil {
+		return fmt.Errorf("failed to mount blob %s from %s: %w", digest, src, err)
+	}
+
+	return nil
+}
+
+// cancelUpload deletes the upload session started by the given response, at its Location, so it
+// isn't left open on the registry. It is best effort: the registry expires the upload anyway.
+func (r *Registry) cancelUpload(client *http.Client, resp *http.Response) {
+	location, err := resp.Location()
+	if err != nil {
+		return
+	}
+
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodDelete, location.String(), nil)
+	if err != nil {
+		return
+	}
+
+	deleteResp, err := client.Do(req)
+	if err != nil {
+		return
+	}
+
+	_ = deleteResp.Body.Close()
+}
+
+// putManifest puts the given raw manifest in the repository under reference (a tag or a digest).
+func (r *Registry) putManifest(
+	client *http.Client, repo name.Repository, reference string, mediaType types.MediaType, raw []byte,
+) error {
+	uri := url.URL{
+		Scheme: repo.Scheme(),
+		Host:   repo.RegistryStr(),
+		Path:   fmt.Sprintf("/v2/%s/manifests/%s", repo.RepositoryStr(), reference),
+	}
+
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodPut, uri.String(), bytes.NewReader(raw))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", string(mediaType))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = transport.CheckError(resp, http.StatusCreated)
+	if err != nil {
+		return fmt.Errorf("failed to put manifest %s: %w", reference, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,284 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"unicode"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+const (
+	// libraryNamespace is the namespace implicitly added to official Docker Hub images.
+	libraryNamespace = "library/"
+	// maxCallerDepth is the depth of the call stack searched for the operation of logged references.
+	maxCallerDepth = 32
+)
+
+// ErrDigestRequired is returned when a tag reference is given to a Registry created WithRequireDigest.
+var ErrDigestRequired = errors.New("digest reference required")
+
+// ErrPrefixRegistryMismatch is returned by New when the repository prefix set with
+// WithRepositoryPrefix is on another registry than the Registry.
+var ErrPrefixRegistryMismatch = errors.New("repository prefix is on another registry")
+
+// parseReference parses the given image reference with the name options of the Registry,
+// enforcing its reference policies.
+func (r *Registry) parseReference(imageRef string) (name.Reference, error) {
+	ref, err := name.ParseReference(r.expandReference(imageRef), r.nameOptions...)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	if _, ok := ref.(name.Digest); r.requireDigest && !ok {
+		return nil, fmt.Errorf("%s is a tag reference: %w", imageRef, ErrDigestRequired)
+	}
+
+	r.logReference(imageRef, ref.Name())
+
+	return ref, nil
+}
+
+// parseDestination parses the given reference of an image to write, which may be a tag.
+func (r *Registry) parseDestination(imageRef string) (name.Reference, error) {
+	ref, err := name.ParseReference(r.expandReference(imageRef), r.nameOptions...)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	r.logReference(imageRef, ref.Name())
+
+	return ref, nil
+}
+
+// newTag parses the given tag reference with the name options of the Registry.
+func (r *Registry) newTag(tagRef string) (name.Tag, error) {
+	tag, err := name.NewTag(r.expandReference(tagRef), r.nameOptions...)
+	if err != nil {
+		return name.Tag{}, err //nolint:wrapcheck
+	}
+
+	r.logReference(tagRef, tag.Name())
+
+	return tag, nil
+}
+
+// newRepository parses the given repository with the name options of the Registry.
+func (r *Registry) newRepository(repository string) (name.Repository, error) {
+	repo, err := name.NewRepository(r.expandReference(repository), r.nameOptions...)
+	if err != nil {
+		return name.Repository{}, err //nolint:wrapcheck
+	}
+
+	r.logReference(repository, repo.Name())
+
+	return repo, nil
+}
+
+// RewriteRule rewrites the references starting with From, replacing this prefix with To, like
+// "old.example.com/team/" to "new.example.com/team/".
+type RewriteRule struct {
+	From string
+	To   string
+}
+
+// expandReference returns the reference to use for the given one: rewritten by the first
+// matching rule set with WithReferenceRewrites, then prefixed with the repository prefix set
+// with WithRepositoryPrefix if it is bare, its digest being normalized with NormalizeDigest.
+func (r *Registry) expandReference(ref string) string {
+	return normalizeReferenceDigest(r.withPrefix(r.rewriteReference(ref)))
+}
+
+// normalizeReferenceDigest normalizes the digest of the given digest reference with
+// NormalizeDigest. Other references, and invalid digests, are returned unchanged.
+func normalizeReferenceDigest(ref string) string {
+	repository, digest, ok := strings.Cut(ref, "@")
+	if !ok {
+		return ref
+	}
+
+	normalized, err := NormalizeDigest(digest)
+	if err != nil {
+		return ref
+	}
+
+	return repository + "@" + normalized
+}
+
+// rewriteReference rewrites the given reference with the first matching rule set with
+// WithReferenceRewrites, and logs the rewrite with the logger set with WithRefLogging.
+func (r *Registry) rewriteReference(ref string) string {
+	for _, rule := range r.rewrites {
+		rest, ok := strings.CutPrefix(ref, rule.From)
+		if !ok {
+			continue
+		}
+
+		rewritten := rule.To + rest
+		if r.refLogger != nil {
+			r.refLogger.InfoContext(r.ctx, "rewrote reference",
+				"operation", callerOperation(), "reference", ref, "rewritten", rewritten)
+		}
+
+		return rewritten
+	}
+
+	return ref
+}
+
+// withPrefix prepends the repository prefix set with WithRepositoryPrefix to the given reference
+// when it is bare, i.e. when it doesn't start with a registry host.
+func (r *Registry) withPrefix(ref string) string {
+	if r.repositoryPrefix == "" {
+		return ref
+	}
+
+	host, _, ok := strings.Cut(ref, "/")
+	if ok && (strings.ContainsAny(host, ".:") || host == "localhost") {
+		return ref
+	}
+
+	return r.repositoryPrefix + "/" + ref
+}
+
+// checkRepositoryPrefix checks that the repository prefix set with WithRepositoryPrefix is a valid
+// repository of the registry of the Registry.
+func (r *Registry) checkRepositoryPrefix() error {
+	repo, err := name.NewRepository(r.repositoryPrefix, r.nameOptions...)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	if repo.RegistryStr() != r.RegistryStr() {
+		return fmt.Errorf("%s is not on registry %s: %w", r.repositoryPrefix, r.RegistryStr(), ErrPrefixRegistryMismatch)
+	}
+
+	return nil
+}
+
+// logReference logs the given reference and its canonical form with the logger set with
+// WithRefLogging, along with the Registry method it was given to.
+func (r *Registry) logReference(original, canonical string) {
+	if r.refLogger == nil {
+		return
+	}
+
+	r.refLogger.InfoContext(r.ctx, "resolved reference",
+		"operation", callerOperation(), "reference", original, "canonical", canonical)
+}
+
+// callerOperation returns the name of the outermost exported Registry method of the call stack.
+func callerOperation() string {
+	pcs := make([]uintptr, maxCallerDepth)
+	// Skip runtime.Callers and callerOperation itself.
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)]) //nolint:mnd
+
+	var operation string
+
+	for {
+		frame, more := frames.Next()
+
+		// Closures of a method, like those run in goroutines, are named after it ("Copy.func1").
+		_, method, ok := strings.Cut(frame.Function, ".(*Registry).")
+		method, _, _ = strings.Cut(method, ".")
+
+		if ok && method != "" && unicode.IsUpper(rune(method[0])) {
+			operation = method
+		}
+
+		if !more {
+			return operation
+		}
+	}
+}
+
+// registry parses the registry part of the URL of the Registry, which is either a bare registry
+// host (like "localhost:5000") or a repository (like "eu.gcr.io/project-id").
+func (r *Registry) registry() (name.Registry, error) {
+	if !strings.Contains(r.URL, "/") {
+		return name.NewRegistry(r.URL, r.nameOptions...)
+	}
+
+	ref, err := name.ParseReference(r.URL, r.nameOptions...)
+	if err != nil {
+		return name.Registry{}, err //nolint:wrapcheck
+	}
+
+	return ref.Context().Registry, nil
+}
+
+// RepositoryPath returns the repository path of the given image ref, as normalized by the name
+// package (e.g. "nginx" becomes "library/nginx").
+//
+// When the Registry is created WithNoLibraryNamespace, the "library/" namespace implicitly added
+// to Docker Hub references is removed, so the path maps 1:1 to the given reference.
+func (r *Registry) RepositoryPath(imageRef string) (string, error) {
+	ref, err := name.ParseReference(r.expandReference(imageRef), r.nameOptions...)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse image reference %s: %w", imageRef, err)
+	}
+
+	path := ref.Context().RepositoryStr()
+	if r.noLibraryNamespace && ref.Context().RegistryStr() == name.DefaultRegistry &&
+		!strings.Contains(imageRef, libraryNamespace) {
+		path = strings.TrimPrefix(path, libraryNamespace)
+	}
+
+	return path, nil
+}
+
+// Classify reports, without any network call, whether the given image ref is a tag reference,
+// a digest reference, or both like "nginx:1.25@sha256:...". A reference without tag nor digest
+// is a tag reference to the implicit "latest" tag.
+func (r *Registry) Classify(imageRef string) (bool, bool, error) {
+	ref, err := name.ParseReference(r.expandReference(imageRef), r.nameOptions...)
+	if err != nil {
+		return false, false, fmt.Errorf("failed to parse image reference %s: %w", imageRef, err)
+	}
+
+	if _, isDigest := ref.(name.Digest); !isDigest {
+		return true, false, nil
+	}
+
+	// The name package drops the tag of a reference with a digest, so look for it in the
+	// last path component of the reference.
+	base, _, _ := strings.Cut(imageRef, "@")
+	isTag := strings.Contains(base[strings.LastIndex(base, "/")+1:], ":")
+
+	return isTag, true, nil
+}
+
+// DedupeReferences normalizes the given references to their canonical form (e.g. "nginx" becomes
+// "index.docker.io/library/nginx:latest"), and returns the unique canonical references in the order
+// they are first seen.
+func (r *Registry) DedupeReferences(refs []string) ([]string, error) {
+	seen := make(map[string]bool, len(refs))
+	unique := make([]string, 0, len(refs))
+
+	for _, imageRef := range refs {
+		ref, err := name.ParseReference(r.expandReference(imageRef), r.nameOptions...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse image reference %s: %w", imageRef, err)
+		}
+
+		if !seen[ref.Name()] {
+			seen[ref.Name()] = true
+			unique = append(unique, ref.Name())
+		}
+	}
+
+	return unique, nil
+}
+
+// destinationOf returns the reference to push a modified version of ref to: the same tag,
+// or the new digest when ref is a digest reference.
+func destinationOf(ref name.Reference, digest v1.Hash) name.Reference {
+	if _, ok := ref.(name.Digest); ok {
+		return ref.Context().Digest(digest.String())
+	}
+
+	return ref
+}
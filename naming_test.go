@@ -0,0 +1,116 @@
+package registry
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRegistryStr(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{url: "localhost:5000", want: "localhost:5000"},
+		{url: "localhost:5000/repo", want: "localhost:5000"},
+		{url: "127.0.0.1:5000/repo:tag", want: "127.0.0.1:5000"},
+		{url: "registry.example.com/nested/repo", want: "registry.example.com"},
+		{url: "eu.gcr.io/project-id", want: "eu.gcr.io"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			t.Parallel()
+
+			r := &Registry{URL: tt.url}
+
+			reg, err := r.registry()
+			if err != nil {
+				t.Fatalf("registry() error = %v", err)
+			}
+
+			if got := reg.RegistryStr(); got != tt.want {
+				t.Errorf("registry().RegistryStr() = %q, want %q", got, tt.want)
+			}
+
+			if got := r.RegistryStr(); got != tt.want {
+				t.Errorf("RegistryStr() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandReference(t *testing.T) {
+	t.Parallel()
+
+	const digest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+	r := &Registry{
+		rewrites: []RewriteRule{
+			{From: "old.example.com/team/", To: "new.example.com/team/"},
+			{From: "old.example.com/", To: "archive.example.com/"},
+		},
+		repositoryPrefix: "registry.example.com/team-a",
+	}
+
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{ref: "myapp:tag", want: "registry.example.com/team-a/myapp:tag"},
+		{ref: "group/myapp", want: "registry.example.com/team-a/group/myapp"},
+		{ref: "other.example.com/myapp:tag", want: "other.example.com/myapp:tag"},
+		{ref: "localhost/myapp", want: "localhost/myapp"},
+		{ref: "localhost:5000/myapp", want: "localhost:5000/myapp"},
+		{ref: "old.example.com/team/myapp:tag", want: "new.example.com/team/myapp:tag"},
+		{ref: "old.example.com/other/myapp", want: "archive.example.com/other/myapp"},
+		{ref: "myapp@SHA256:" + strings.ToUpper(digest[7:]), want: "registry.example.com/team-a/myapp@" + digest},
+		{ref: "myapp@" + digest[7:], want: "registry.example.com/team-a/myapp@" + digest},
+		{ref: "myapp@sha256:invalid", want: "registry.example.com/team-a/myapp@sha256:invalid"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			t.Parallel()
+
+			if got := r.expandReference(tt.ref); got != tt.want {
+				t.Errorf("expandReference() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDedupeReferences(t *testing.T) {
+	t.Parallel()
+
+	r := &Registry{}
+
+	got, err := r.DedupeReferences([]string{
+		"nginx",
+		"docker.io/library/nginx:latest",
+		"index.docker.io/library/nginx",
+		"nginx:1.25",
+		"ghcr.io/org/app",
+		"nginx:latest",
+		"ghcr.io/org/app:latest",
+	})
+	if err != nil {
+		t.Fatalf("DedupeReferences() error = %v", err)
+	}
+
+	want := []string{
+		"index.docker.io/library/nginx:latest",
+		"index.docker.io/library/nginx:1.25",
+		"ghcr.io/org/app:latest",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("DedupeReferences() = %v, want %v", got, want)
+	}
+
+	_, err = r.DedupeReferences([]string{"nginx", "Invalid Reference"})
+	if err == nil {
+		t.Error("DedupeReferences() error = nil, want an error for an invalid reference")
+	}
+}
@@ -0,0 +1,137 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+)
+
+// ErrOffline is returned by a Registry created WithOfflineLayout for every request to the
+// registry, and for the images missing from the layout.
+var ErrOffline = errors.New("registry is offline")
+
+// offlineTransport is an http.RoundTripper failing every request with ErrOffline.
+type offlineTransport struct{}
+
+// RoundTrip implements http.RoundTripper.
+func (offlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, fmt.Errorf("%s %s: %w", req.Method, req.URL, ErrOffline)
+}
+
+// layoutDescriptor looks for the given ref in the offline layout: a tag reference matches the
+// descriptors of the layout index annotated with it (as written by PullIncremental), a digest
+// reference matches any manifest of the layout index or of its nested indexes. It returns the
+// index holding the descriptor along with it.
+func (r *Registry) layoutDescriptor(ref name.Reference) (v1.ImageIndex, v1.Descriptor, error) {
+	path, err := layout.FromPath(r.offlineLayout)
+	if err != nil {
+		return nil, v1.Descriptor{}, fmt.Errorf("failed to open layout %s: %w", r.offlineLayout, err)
+	}
+
+	idx, err := path.ImageIndex()
+	if err != nil {
+		return nil, v1.Descriptor{}, fmt.Errorf("failed to read index of layout %s: %w", r.offlineLayout, err)
+	}
+
+	parent, desc, ok, err := r.findLayoutDescriptor(idx, ref)
+	if err != nil {
+		return nil, v1.Descriptor{}, fmt.Errorf("failed to search layout %s: %w", r.offlineLayout, err)
+	}
+
+	if !ok {
+		return nil, v1.Descriptor{}, fmt.Errorf("%s is not in layout %s: %w", ref, r.offlineLayout, ErrOffline)
+	}
+
+	return parent, desc, nil
+}
+
+// findLayoutDescriptor looks for the given ref in the given index, see layoutDescriptor.
+func (r *Registry) findLayoutDescriptor(
+	idx v1.ImageIndex, ref name.Reference,
+) (v1.ImageIndex, v1.Descriptor, bool, error) {
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		return nil, v1.Descriptor{}, false, fmt.Errorf("failed to get index manifest: %w", err)
+	}
+
+	digest, isDigest := ref.(name.Digest)
+
+	for _, child := range manifest.Manifests {
+		if isDigest && child.Digest.String() == digest.DigestStr() {
+			return idx, child, true, nil
+		}
+
+		if !isDigest && child.Annotations[annotationRefName] == ref.Name() {
+			return idx, child, true, nil
+		}
+	}
+
+	if !isDigest {
+		return nil, v1.Descriptor{}, false, nil
+	}
+
+	for _, child := range manifest.Manifests {
+		if !child.MediaType.IsIndex() {
+			continue
+		}
+
+		childIdx, err := idx.ImageIndex(child.Digest)
+		if err != nil {
+			return nil, v1.Descriptor{}, false, fmt.Errorf("failed to get index %s: %w", child.Digest, err)
+		}
+
+		parent, desc, ok, err := r.findLayoutDescriptor(childIdx, ref)
+		if err != nil || ok {
+			return parent, desc, ok, err
+		}
+	}
+
+	return nil, v1.Descriptor{}, false, nil
+}
+
+// layoutImage returns the given image from the offline layout. For an index, it is the image
+// matching the default platform or, if there is none, the one matching the fallback platform
+// when WithPlatformFallback is set.
+func (r *Registry) layoutImage(ref name.Reference) (v1.Image, error) {
+	parent, desc, err := r.layoutDescriptor(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	if !desc.MediaType.IsIndex() {
+		return parent.Image(desc.Digest) //nolint:wrapcheck
+	}
+
+	idx, err := parent.ImageIndex(desc.Digest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get index %s: %w", desc.Digest, err)
+	}
+
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get index manifest %s: %w", desc.Digest, err)
+	}
+
+	requested := []v1.Platform{{OS: "linux", Architecture: "amd64"}}
+	if r.defaultPlatform != nil {
+		requested[0] = *r.defaultPlatform
+	}
+
+	if r.platformFallback != nil {
+		requested = append(requested, *r.platformFallback)
+	}
+
+	for _, platform := range requested {
+		for _, child := range manifest.Manifests {
+			if child.Platform != nil && child.Platform.Satisfies(platform) {
+				return idx.Image(child.Digest) //nolint:wrapcheck
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("failed to find image %s for platform %s: %w", ref, requested[0].String(), ErrPlatformNotFound)
+}
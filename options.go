@@ -0,0 +1,348 @@
+package registry
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// Option configures a Registry created with New.
+type Option func(*Registry)
+
+// CallOption configures a single call to a Registry method, overriding the Registry
+// configuration for that call only.
+type CallOption func(*callOptions)
+
+// callOptions holds the configuration of a single call.
+type callOptions struct {
+	skipTLSVerify bool
+	noOverwrite   bool
+	streamLayers  bool
+	write         bool
+	auth          authn.Authenticator
+}
+
+// makeCallOptions applies the given call options.
+func makeCallOptions(opts []CallOption) callOptions {
+	var co callOptions
+	for _, opt := range opts {
+		opt(&co)
+	}
+
+	return co
+}
+
+// WithContext sets the context used by all the requests sent to the registry: once it is
+// canceled, the pending and following operations fail.
+func WithContext(ctx context.Context) Option {
+	return func(r *Registry) {
+		r.ctx = ctx
+	}
+}
+
+// WithClock sets the Clock used by the time-dependent logic of the Registry, like the operation
+// deadline or the post-write verification delays, which are waited on with its timers when it
+// implements TimerClock. It defaults to a real clock backed by time.Now.
+func WithClock(clock Clock) Option {
+	return func(r *Registry) {
+		r.clock = clock
+	}
+}
+
+// WithHeader adds a header to every request sent to the registry.
+// It can be given several times to set multiple headers.
+func WithHeader(key, value string) Option {
+	return func(r *Registry) {
+		if r.headers == nil {
+			r.headers = make(http.Header)
+		}
+
+		r.headers.Add(key, value)
+	}
+}
+
+// WithAcceptMediaTypes puts the given media types first, in this order, in the Accept header of the
+// manifest requests, for instance to get the OCI manifests of registries able to serve the same
+// content as docker schema2 manifests. The other media types supported by the request remain
+// accepted after them.
+func WithAcceptMediaTypes(mediaTypes ...types.MediaType) Option {
+	return func(r *Registry) {
+		r.acceptMediaTypes = append(r.acceptMediaTypes, mediaTypes...)
+	}
+}
+
+// WithNoLibraryNamespace disables the "library/" namespace implicitly added to Docker Hub
+// references when computing repository paths with RepositoryPath.
+func WithNoLibraryNamespace() Option {
+	return func(r *Registry) {
+		r.noLibraryNamespace = true
+	}
+}
+
+// WithNoImplicitDockerHub resolves the references without registry host, like "myapp:tag",
+// against the host of the Registry instead of Docker Hub, so a mistyped internal image name is
+// never looked up on Docker Hub.
+func WithNoImplicitDockerHub() Option {
+	return func(r *Registry) {
+		r.noImplicitDockerHub = true
+	}
+}
+
+// WithReferenceRewrites rewrites the references given to the Registry methods starting with the
+// From prefix of one of the given rules, replacing it with its To prefix, so that the references
+// to a deprecated registry host are redirected to a new one. The first matching rule applies.
+// Rewrites are logged with the logger set with WithRefLogging.
+func WithReferenceRewrites(rules []RewriteRule) Option {
+	return func(r *Registry) {
+		r.rewrites = append(r.rewrites, rules...)
+	}
+}
+
+// WithRepositoryPrefix scopes the Registry to a subpath of the registry, like
+// "registry.example.com/team-a": the prefix is prepended to the bare references given to the
+// Registry methods, so "myapp:tag" resolves to "registry.example.com/team-a/myapp:tag".
+// References starting with a registry host are used as is. New fails with
+// ErrPrefixRegistryMismatch if the prefix is on another registry than the Registry.
+func WithRepositoryPrefix(prefix string) Option {
+	return func(r *Registry) {
+		r.repositoryPrefix = strings.TrimSuffix(prefix, "/")
+	}
+}
+
+// WithAPIVersion pins the registry API version: every connection to the registry fails with
+// ErrAPIVersionMismatch unless its /v2/ endpoint advertises this version through the
+// Docker-Distribution-API-Version header. Only "v2" is supported.
+func WithAPIVersion(version string) Option {
+	return func(r *Registry) {
+		r.apiVersion = version
+	}
+}
+
+// WithDefaultPlatform sets the platform used to resolve indexes to a single image in the methods
+// working on images (Inspect, Image, Size...). Methods working on the index itself, like Head,
+// are unaffected.
+func WithDefaultPlatform(platform v1.Platform) Option {
+	return func(r *Registry) {
+		r.defaultPlatform = &platform
+	}
+}
+
+// WithPlatformFallback sets the platform used to resolve indexes to a single image when they have
+// no image for the default platform (linux/amd64 unless set with WithDefaultPlatform), for instance
+// to run linux/amd64 images through emulation when no native image is available.
+func WithPlatformFallback(platform v1.Platform) Option {
+	return func(r *Registry) {
+		r.platformFallback = &platform
+	}
+}
+
+// WithSchema1Conversion converts the deprecated docker schema1 manifests to images on the fly in
+// the methods working on images (Inspect, Image, Size...), instead of failing with a Schema1Error.
+func WithSchema1Conversion() Option {
+	return func(r *Registry) {
+		r.schema1Conversion = true
+	}
+}
+
+// WithNameOptions sets the options used to parse every reference given to the Registry, such as
+// name.StrictValidation to require fully-qualified references, or name.Insecure to allow plain http.
+func WithNameOptions(opts ...name.Option) Option {
+	return func(r *Registry) {
+		r.nameOptions = append(r.nameOptions, opts...)
+	}
+}
+
+// WithMaxResponseBodySize bounds the size of the responses read from the registry, such as
+// manifests and configs, to protect against untrusted registries: reading more than size bytes
+// fails with ErrResponseTooLarge. Methods streaming layers (LayerReader, Copy...) are not bounded.
+func WithMaxResponseBodySize(size int64) Option {
+	return func(r *Registry) {
+		r.maxResponseBodySize = size
+	}
+}
+
+// WithBlobRetry resumes the blob downloads interrupted by a transient stream error, like an
+// unexpected EOF or a connection reset, with a Range request starting at the last received byte,
+// up to maxAttempts times per blob. Reading fails with ErrResumeUnsupported if the registry
+// doesn't honor the Range request. Unlike a retry of the whole request, nothing is downloaded twice.
+func WithBlobRetry(maxAttempts int) Option {
+	return func(r *Registry) {
+		r.blobRetryAttempts = maxAttempts
+	}
+}
+
+// WithOperationDeadline bounds the total duration of each call to the registry, like fetching a
+// manifest or writing an image, its retries and their backoff included: once d has elapsed since
+// the call started, its requests fail with context.DeadlineExceeded, which stops the retries.
+// A deadline of the context of the Registry still applies if it is sooner.
+//
+// The backoff between two retries of the remote package can't be interrupted, so a call may end
+// up to one backoff step after the deadline.
+func WithOperationDeadline(d time.Duration) Option {
+	return func(r *Registry) {
+		r.operationDeadline = d
+	}
+}
+
+// WithBackoffJitter randomizes each delay between two retries of a request by up to the given
+// fraction of it (0.1 by default, 0 disables it), so that the clients retrying a throttled
+// registry at the same time don't keep colliding. The delays start at 1s and are tripled after
+// each of the 3 retries.
+func WithBackoffJitter(fraction float64) Option {
+	return func(r *Registry) {
+		r.backoffJitter = fraction
+	}
+}
+
+// WithRequireDigest makes every method fail with ErrDigestRequired when given a tag reference of
+// an image to read, so images are only ever referenced by their immutable digest.
+// References of images to write (like the destination of a Copy) are not affected.
+func WithRequireDigest() Option {
+	return func(r *Registry) {
+		r.requireDigest = true
+	}
+}
+
+// WithBearerToken makes the Registry authenticate with the given pre-obtained registry bearer token,
+// bypassing the resolution of credentials. Registry tokens are usually issued for specific
+// repositories and actions: calls outside the scopes of the token are rejected by the registry.
+func WithBearerToken(token string) Option {
+	return func(r *Registry) {
+		r.bearerToken = token
+	}
+}
+
+// WithRefLogging logs, at info level, every reference given to the Registry methods along with
+// its canonical form (e.g. "nginx" is "index.docker.io/library/nginx:latest") and the method.
+func WithRefLogging(logger *slog.Logger) Option {
+	return func(r *Registry) {
+		r.refLogger = logger
+	}
+}
+
+// WithEventSink sets the EventSink receiving an Event for each operation completed on the registry
+// by the Head, GetDescriptor, Inspect, Image, Delete, Retag, PointTag, Copy, CopyWithin, Push,
+// SetLabels and PushArtifact methods.
+func WithEventSink(sink EventSink) Option {
+	return func(r *Registry) {
+		r.eventSink = sink
+	}
+}
+
+// WithOfflineLayout disables every network access of the Registry, for air-gapped environments:
+// Head, Inspect, Image (and the other methods reading an image config or manifest, like ImageID)
+// are served from the OCI layout at path, as written by PullIncremental, and the images missing
+// from the layout as well as all the other requests fail with ErrOffline.
+func WithOfflineLayout(path string) Option {
+	return func(r *Registry) {
+		r.offlineLayout = path
+	}
+}
+
+// WithKeychains sets the keychains resolving the credentials of the registries, tried in order,
+// in place of the default keychain. They resolve the credentials of the registry of the Registry
+// when no other credentials are found (see New), and those of any other registry it reaches.
+func WithKeychains(keychains ...authn.Keychain) Option {
+	return func(r *Registry) {
+		r.keychain = authn.NewMultiKeychain(keychains...)
+	}
+}
+
+// WithRequireAuth makes New fail with ErrAnonymousCredentials when no credentials are found for
+// the registry, instead of accessing it anonymously and failing later with 401 errors on private
+// repositories. It also applies when the credentials are resolved again after a 401 error.
+func WithRequireAuth() Option {
+	return func(r *Registry) {
+		r.requireAuth = true
+	}
+}
+
+// WithHTTPClient sets the http.Client whose transport and timeout are used by every request sent
+// to the registry. It takes precedence over WithReadTransport and WithWriteTransport.
+func WithHTTPClient(client *http.Client) Option {
+	return func(r *Registry) {
+		r.httpClient = client
+	}
+}
+
+// WithPostWriteVerify makes the methods writing a reference (Retag, Copy, Push...) check that it
+// resolves to the written digest before returning, retrying for a few seconds on eventually-consistent
+// registries. They fail with ErrWriteNotVisible if it doesn't.
+func WithPostWriteVerify() Option {
+	return func(r *Registry) {
+		r.postWriteVerify = true
+	}
+}
+
+// WithPinTags makes the Registry remember the digest each tag resolves to the first time, and fail
+// with ErrTagMutated if it later resolves to another digest, to defend against tags swapped while
+// in use. Tags written through the Registry (with Retag, Copy...) are pinned to their new digest.
+func WithPinTags() Option {
+	return func(r *Registry) {
+		r.pins = &tagPins{digests: make(map[string]string)}
+	}
+}
+
+// WithReadTransport sets the http.RoundTripper used by the requests reading from the registry
+// (Head, Inspect, RefExists, ListTags...), for instance to go through a caching proxy.
+// It also sets the write transport unless WithWriteTransport is given.
+func WithReadTransport(rt http.RoundTripper) Option {
+	return func(r *Registry) {
+		r.readTransport = rt
+	}
+}
+
+// WithWriteTransport sets the http.RoundTripper used by the requests writing to the registry
+// (Retag, Copy, PushArtifact...). It also sets the read transport unless WithReadTransport is given.
+func WithWriteTransport(rt http.RoundTripper) Option {
+	return func(r *Registry) {
+		r.writeTransport = rt
+	}
+}
+
+// WithSkipTLSVerify disables the verification of the registry TLS certificate for a single call.
+// It should only be used for one-off calls against misconfigured hosts. The transport set with
+// WithReadTransport, WithWriteTransport or WithHTTPClient, if any, must be an *http.Transport:
+// otherwise the call fails with ErrSkipTLSVerifyUnsupported.
+func WithSkipTLSVerify() CallOption {
+	return func(co *callOptions) {
+		co.skipTLSVerify = true
+	}
+}
+
+// WithNoOverwrite makes Retag create the tag only if it doesn't exist yet: it fails with
+// ErrTagExists when the tag already points to another digest.
+func WithNoOverwrite() CallOption {
+	return func(co *callOptions) {
+		co.noOverwrite = true
+	}
+}
+
+// WithCallAuth overrides the authenticator of the Registry for a single call, for instance to
+// perform a privileged operation as another identity.
+func WithCallAuth(auth authn.Authenticator) CallOption {
+	return func(co *callOptions) {
+		co.auth = auth
+	}
+}
+
+// withLayerStreaming marks a call as streaming layers, so it isn't bounded by WithMaxResponseBodySize.
+func withLayerStreaming() CallOption {
+	return func(co *callOptions) {
+		co.streamLayers = true
+	}
+}
+
+// withWrite marks a call as writing to the registry, so it goes through the write transport.
+func withWrite() CallOption {
+	return func(co *callOptions) {
+		co.write = true
+	}
+}
@@ -0,0 +1,350 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// annotationReferenceType is the annotation set by BuildKit on the attestation manifests of an index.
+const annotationReferenceType = "vnd.docker.reference.type"
+
+// annotationReferenceDigest is the annotation set by BuildKit on the attestation manifests of an
+// index to the digest of the image they are attached to.
+const annotationReferenceDigest = "vnd.docker.reference.digest"
+
+var (
+	// ErrImageIsIndex is returned when a single-platform image is expected but the ref points to an index.
+	ErrImageIsIndex = errors.New("image is a multi-platform index, use Platforms instead")
+	// ErrPlatformNotFound is returned by PlatformDigest when no image matches the requested platform.
+	ErrPlatformNotFound = errors.New("no image matches platform")
+)
+
+// ImagePlatform returns the platform (OS, architecture, variant and OS version) of the given
+// single-platform image, as read from its config. It fails with ErrImageIsIndex for an index.
+func (r *Registry) ImagePlatform(imageRef string) (v1.Platform, error) {
+	ref, err := r.parseReference(imageRef)
+	if err != nil {
+		return v1.Platform{}, fmt.Errorf("failed to parse image reference %s: %w", imageRef, err)
+	}
+
+	var cfg *v1.ConfigFile
+
+	err = r.withAuthRefresh(func() error {
+		desc, err := remote.Get(ref, r.remoteOptions()...)
+		if err != nil {
+			return err
+		}
+
+		if desc.MediaType.IsIndex() {
+			return ErrImageIsIndex
+		}
+
+		img, err := desc.Image()
+		if err != nil {
+			return err
+		}
+
+		cfg, err = img.ConfigFile()
+
+		return err
+	})
+	if err != nil {
+		return v1.Platform{}, fmt.Errorf("failed to get platform from remote for image %s: %w", imageRef, err)
+	}
+
+	return configPlatform(cfg), nil
+}
+
+// configPlatform returns the platform described by the given image config.
+func configPlatform(cfg *v1.ConfigFile) v1.Platform {
+	return v1.Platform{
+		OS:           cfg.OS,
+		Architecture: cfg.Architecture,
+		Variant:      cfg.Variant,
+		OSVersion:    cfg.OSVersion,
+	}
+}
+
+// Platforms returns the platforms of the images referenced by the given index, attestation
+// manifests excluded (see Attestations). For a single-platform image, the platform read from
+// its config is returned.
+func (r *Registry) Platforms(imageRef string) ([]v1.Platform, error) {
+	ref, err := r.parseReference(imageRef)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse image reference %s: %w", imageRef, err)
+	}
+
+	var (
+		desc *remote.Descriptor
+		cfg  *v1.ConfigFile
+	)
+
+	err = r.withAuthRefresh(func() error {
+		desc, err = remote.Get(ref, r.remoteOptions()...)
+		if err != nil || desc.MediaType.IsIndex() {
+			return err
+		}
+
+		img, err := desc.Image()
+		if err != nil {
+			return err
+		}
+
+		cfg, err = img.ConfigFile()
+
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get manifest from remote for image %s: %w", imageRef, err)
+	}
+
+	if cfg != nil {
+		return []v1.Platform{configPlatform(cfg)}, nil
+	}
+
+	index, err := desc.ImageIndex()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get index from remote for image %s: %w", imageRef, err)
+	}
+
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get index manifest from remote for image %s: %w", imageRef, err)
+	}
+
+	platforms := make([]v1.Platform, 0, len(manifest.Manifests))
+	for _, child := range manifest.Manifests {
+		if child.Platform != nil && !isAttestation(child) {
+			platforms = append(platforms, *child.Platform)
+		}
+	}
+
+	return platforms, nil
+}
+
+// SupportsPlatform reports whether the given image can run on the given platform: for an index,
+// one of its images must match the platform, otherwise the image config must match it.
+//
+// OS and architecture must be equal, an empty variant (requested or provided) matches any variant.
+func (r *Registry) SupportsPlatform(imageRef string, platform v1.Platform) (bool, error) {
+	platforms, err := r.Platforms(imageRef)
+	if err != nil {
+		return false, err
+	}
+
+	for _, candidate := range platforms {
+		if platformMatches(candidate, platform) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// IsWindows reports whether the given image is a Windows image, as read from its config, or for
+// an index whether one of its images is, which then likely references foreign layers (see
+// ForeignLayerURLs).
+func (r *Registry) IsWindows(imageRef string) (bool, error) {
+	platforms, err := r.Platforms(imageRef)
+	if err != nil {
+		return false, err
+	}
+
+	for _, platform := range platforms {
+		if platform.OS == "windows" {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Attestations returns the descriptors of the attestation manifests (like the provenance and
+// SBOM attestations of BuildKit) of the given index, identified by their "vnd.docker.reference.type"
+// annotation. It returns none for a single-platform image.
+func (r *Registry) Attestations(imageRef string) ([]v1.Descriptor, error) {
+	ref, err := r.parseReference(imageRef)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse image reference %s: %w", imageRef, err)
+	}
+
+	var desc *remote.Descriptor
+
+	err = r.withAuthRefresh(func() error {
+		desc, err = remote.Get(ref, r.remoteOptions()...)
+
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get manifest from remote for image %s: %w", imageRef, err)
+	}
+
+	if !desc.MediaType.IsIndex() {
+		return nil, nil
+	}
+
+	index, err := desc.ImageIndex()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get index from remote for image %s: %w", imageRef, err)
+	}
+
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get index manifest from remote for image %s: %w", imageRef, err)
+	}
+
+	var attestations []v1.Descriptor
+
+	for _, child := range manifest.Manifests {
+		if isAttestation(child) {
+			attestations = append(attestations, child)
+		}
+	}
+
+	return attestations, nil
+}
+
+// isAttestation reports whether the given index child is an attestation manifest.
+func isAttestation(child v1.Descriptor) bool {
+	_, ok := child.Annotations[annotationReferenceType]
+
+	return ok
+}
+
+// PlatformDigest returns the digest reference of the image of the given index matching the given
+// platform, as defined by SupportsPlatform, attestation manifests excluded. For a single-platform
+// image, its own digest is returned if its config matches the platform. It fails with
+// ErrPlatformNotFound otherwise.
+func (r *Registry) PlatformDigest(imageRef string, platform v1.Platform) (name.Digest, error) {
+	ref, err := r.parseReference(imageRef)
+	if err != nil {
+		return name.Digest{}, fmt.Errorf("failed to parse image reference %s: %w", imageRef, err)
+	}
+
+	var (
+		desc *remote.Descriptor
+		cfg  *v1.ConfigFile
+	)
+
+	err = r.withAuthRefresh(func() error {
+		desc, err = remote.Get(ref, r.remoteOptions()...)
+		if err != nil || desc.MediaType.IsIndex() {
+			return err
+		}
+
+		img, err := desc.Image()
+		if err != nil {
+			return err
+		}
+
+		cfg, err = img.ConfigFile()
+
+		return err
+	})
+	if err != nil {
+		return name.Digest{}, fmt.Errorf("failed to get manifest from remote for image %s: %w", imageRef, err)
+	}
+
+	if cfg != nil {
+		if !platformMatches(configPlatform(cfg), platform) {
+			return name.Digest{}, fmt.Errorf("failed to find image %s for platform %s: %w",
+				imageRef, platform.String(), ErrPlatformNotFound)
+		}
+
+		return ref.Context().Digest(desc.Digest.String()), nil
+	}
+
+	index, err := desc.ImageIndex()
+	if err != nil {
+		return name.Digest{}, fmt.Errorf("failed to get index from remote for image %s: %w", imageRef, err)
+	}
+
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		return name.Digest{}, fmt.Errorf("failed to get index manifest from remote for image %s: %w", imageRef, err)
+	}
+
+	for _, child := range manifest.Manifests {
+		if child.Platform != nil && !isAttestation(child) && platformMatches(*child.Platform, platform) {
+			return ref.Context().Digest(child.Digest.String()), nil
+		}
+	}
+
+	return name.Digest{}, fmt.Errorf("failed to find image %s for platform %s: %w",
+		imageRef, platform.String(), ErrPlatformNotFound)
+}
+
+// remoteImage fetches the given image, resolving an index to a single image like descriptorImage.
+// With WithOfflineLayout, the image is read from the layout instead.
+func (r *Registry) remoteImage(ref name.Reference, opts ...CallOption) (v1.Image, error) {
+	if r.offlineLayout != "" {
+		return r.layoutImage(ref)
+	}
+
+	desc, err := remote.Get(ref, r.imageOptions(opts...)...)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	return r.descriptorImage(desc)
+}
+
+// descriptorImage returns the image of the given descriptor, fetched with the image options.
+// For an index, it is the image matching the default platform or, if there is none, the one
+// matching the fallback platform when WithPlatformFallback is set. A schema1 manifest is
+// converted when WithSchema1Conversion is set, and fails with a Schema1Error otherwise.
+func (r *Registry) descriptorImage(desc *remote.Descriptor) (v1.Image, error) {
+	if isSchema1(desc.MediaType) {
+		if !r.schema1Conversion {
+			return nil, &Schema1Error{MediaType: desc.MediaType, Raw: desc.Manifest}
+		}
+
+		return desc.Schema1() //nolint:wrapcheck
+	}
+
+	if !desc.MediaType.IsIndex() || r.platformFallback == nil {
+		return desc.Image() //nolint:wrapcheck
+	}
+
+	idx, err := desc.ImageIndex()
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	requested := v1.Platform{OS: "linux", Architecture: "amd64"}
+	if r.defaultPlatform != nil {
+		requested = *r.defaultPlatform
+	}
+
+	for _, child := range manifest.Manifests {
+		if child.Platform != nil && child.Platform.Satisfies(requested) {
+			return desc.Image() //nolint:wrapcheck
+		}
+	}
+
+	for _, child := range manifest.Manifests {
+		if child.Platform != nil && child.Platform.Satisfies(*r.platformFallback) {
+			return idx.Image(child.Digest) //nolint:wrapcheck
+		}
+	}
+
+	return desc.Image() //nolint:wrapcheck
+}
+
+// platformMatches reports whether the candidate platform satisfies the requested one.
+func platformMatches(candidate, requested v1.Platform) bool {
+	if candidate.OS != requested.OS || candidate.Architecture != requested.Architecture {
+		return false
+	}
+
+	return candidate.Variant == "" || requested.Variant == "" || candidate.Variant == requested.Variant
+}
@@ -0,0 +1,199 @@
+package registry
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// newAttestedIndex returns an index holding a linux/amd64 image and, like BuildKit, its
+// attestation manifest with the unknown/unknown platform.
+func newAttestedIndex(t *testing.T) v1.ImageIndex {
+	t.Helper()
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() error = %v", err)
+	}
+
+	img, err = mutate.ConfigFile(img, &v1.ConfigFile{OS: "linux", Architecture: "amd64"})
+	if err != nil {
+		t.Fatalf("mutate.ConfigFile() error = %v", err)
+	}
+
+	digest, err := img.Digest()
+	if err != nil {
+		t.Fatalf("img.Digest() error = %v", err)
+	}
+
+	attestation, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() error = %v", err)
+	}
+
+	return mutate.AppendManifests(empty.Index,
+		mutate.IndexAddendum{
+			Add:        img,
+			Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: "amd64"}},
+		},
+		mutate.IndexAddendum{
+			Add: attestation,
+			Descriptor: v1.Descriptor{
+				Platform: &v1.Platform{OS: "unknown", Architecture: "unknown"},
+				Annotations: map[string]string{
+					annotationReferenceType:   "attestation-manifest",
+					annotationReferenceDigest: digest.String(),
+				},
+			},
+		},
+	)
+}
+
+func TestPlatformMatches(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		candidate v1.Platform
+		requested v1.Platform
+		want      bool
+	}{
+		{
+			name:      "equal",
+			candidate: v1.Platform{OS: "linux", Architecture: "amd64"},
+			requested: v1.Platform{OS: "linux", Architecture: "amd64"},
+			want:      true,
+		},
+		{
+			name:      "other architecture",
+			candidate: v1.Platform{OS: "linux", Architecture: "arm64"},
+			requested: v1.Platform{OS: "linux", Architecture: "amd64"},
+		},
+		{
+			name:      "other os",
+			candidate: v1.Platform{OS: "windows", Architecture: "amd64"},
+			requested: v1.Platform{OS: "linux", Architecture: "amd64"},
+		},
+		{
+			name:      "same variant",
+			candidate: v1.Platform{OS: "linux", Architecture: "arm", Variant: "v7"},
+			requested: v1.Platform{OS: "linux", Architecture: "arm", Variant: "v7"},
+			want:      true,
+		},
+		{
+			name:      "other variant",
+			candidate: v1.Platform{OS: "linux", Architecture: "arm", Variant: "v6"},
+			requested: v1.Platform{OS: "linux", Architecture: "arm", Variant: "v7"},
+		},
+		{
+			name:      "any requested variant",
+			candidate: v1.Platform{OS: "linux", Architecture: "arm", Variant: "v6"},
+			requested: v1.Platform{OS: "linux", Architecture: "arm"},
+			want:      true,
+		},
+		{
+			name:      "any provided variant",
+			candidate: v1.Platform{OS: "linux", Architecture: "arm"},
+			requested: v1.Platform{OS: "linux", Architecture: "arm", Variant: "v7"},
+			want:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := platformMatches(tt.candidate, tt.requested); got != tt.want {
+				t.Errorf("platformMatches() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlatformDigest(t *testing.T) {
+	t.Parallel()
+
+	host := startTestRegistry(t, nil)
+	idx := newAttestedIndex(t)
+
+	ref, err := name.ParseReference(host + "/test/app:latest")
+	if err != nil {
+		t.Fatalf("name.ParseReference() error = %v", err)
+	}
+
+	err = remote.WriteIndex(ref, idx)
+	if err != nil {
+		t.Fatalf("remote.WriteIndex() error = %v", err)
+	}
+
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		t.Fatalf("idx.IndexManifest() error = %v", err)
+	}
+
+	imageDigest := manifest.Manifests[0].Digest
+
+	single, err := name.ParseReference(host + "/test/app@" + imageDigest.String())
+	if err != nil {
+		t.Fatalf("name.ParseReference() error = %v", err)
+	}
+
+	r, err := New(host)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		ref      string
+		platform v1.Platform
+		want     v1.Hash
+		wantErr  error
+	}{
+		{
+			name:     "index",
+			ref:      ref.String(),
+			platform: v1.Platform{OS: "linux", Architecture: "amd64"},
+			want:     imageDigest,
+		},
+		{
+			name:     "index attestation",
+			ref:      ref.String(),
+			platform: v1.Platform{OS: "unknown", Architecture: "unknown"},
+			wantErr:  ErrPlatformNotFound,
+		},
+		{
+			name:     "image",
+			ref:      single.String(),
+			platform: v1.Platform{OS: "linux", Architecture: "amd64"},
+			want:     imageDigest,
+		},
+		{
+			name:     "image of another platform",
+			ref:      single.String(),
+			platform: v1.Platform{OS: "linux", Architecture: "arm64"},
+			wantErr:  ErrPlatformNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := r.PlatformDigest(tt.ref, tt.platform)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("PlatformDigest() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr == nil && got.DigestStr() != tt.want.String() {
+				t.Errorf("PlatformDigest() = %s, want %s", got.DigestStr(), tt.want)
+			}
+		})
+	}
+}
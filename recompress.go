@@ -0,0 +1,86 @@
+package registry
+
+import (
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/compression"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// Compression is a layer compression algorithm.
+type Compression = compression.Compression
+
+const (
+	// CompressionGzip compresses layers with gzip.
+	CompressionGzip Compression = compression.GZip
+	// CompressionZstd compresses layers with zstd, which is only supported by OCI media types.
+	CompressionZstd Compression = compression.ZStd
+)
+
+// WithRecompress decompresses each layer and compresses it again with the given algorithm during
+// a Copy. Layers already compressed with it are kept as is. Since docker media types don't support
+// zstd, images recompressed with zstd are converted to OCI media types.
+//
+// The digests of the recompressed layers, and therefore of the copied content, change. Each layer
+// is recompressed once, its output being kept in memory until it is uploaded.
+func WithRecompress(algo Compression) CopyOption {
+	return func(co *copyOptions) {
+		co.recompress = algo
+	}
+}
+
+// recompressImage compresses again the distributable layers of the given image with the given algorithm.
+func recompressImage(img v1.Image, algo Compression) (v1.Image, error) {
+	manifest, err := img.Manifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get manifest: %w", err)
+	}
+
+	conversion := noConversion
+	if algo == CompressionZstd {
+		conversion = convertToOCI
+	}
+
+	return rebuildImage(img, conversion.convert(manifest.MediaType), conversion.convert(manifest.Config.MediaType),
+		func(layer v1.Layer, desc v1.Descriptor) (mutate.Addendum, error) {
+			mediaType := recompressedMediaType(manifest.MediaType, algo)
+			if !desc.MediaType.IsLayer() || !desc.MediaType.IsDistributable() || mediaType == desc.MediaType {
+				return mutate.Addendum{
+					Layer:       layer,
+					MediaType:   conversion.convert(desc.MediaType),
+					URLs:        desc.URLs,
+					Annotations: desc.Annotations,
+				}, nil
+			}
+
+			// The compressed output is cached, so computing the digest and uploading the layer
+			// don't both recompress it.
+			recompressed, err := tarball.LayerFromOpener(layer.Uncompressed,
+				tarball.WithCompression(algo), tarball.WithMediaType(mediaType), tarball.WithCompressedCaching)
+			if err != nil {
+				return mutate.Addendum{}, fmt.Errorf("failed to recompress layer: %w", err)
+			}
+
+			return mutate.Addendum{
+				Layer:       recompressed,
+				MediaType:   mediaType,
+				Annotations: desc.Annotations,
+			}, nil
+		})
+}
+
+// recompressedMediaType returns the media type of a layer of an image with the given manifest media
+// type, once recompressed with the given algorithm.
+func recompressedMediaType(manifestMediaType types.MediaType, algo Compression) types.MediaType {
+	switch {
+	case algo == CompressionZstd:
+		return types.OCILayerZStd
+	case manifestMediaType == types.DockerManifestSchema2:
+		return types.DockerLayer
+	default:
+		return types.OCILayer
+	}
+}
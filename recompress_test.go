@@ -0,0 +1,80 @@
+package registry
+
+import (
+	"io"
+	"sync/atomic"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+// countingLayer is a v1.Layer counting how many times its uncompressed content is read.
+type countingLayer struct {
+	v1.Layer
+
+	opens atomic.Int32
+}
+
+func (l *countingLayer) Uncompressed() (io.ReadCloser, error) {
+	l.opens.Add(1)
+
+	return l.Layer.Uncompressed() //nolint:wrapcheck
+}
+
+func TestRecompressImageReadsLayersOnce(t *testing.T) {
+	t.Parallel()
+
+	source, err := random.Layer(4096, "application/vnd.oci.image.layer.v1.tar+gzip")
+	if err != nil {
+		t.Fatalf("random.Layer() error = %v", err)
+	}
+
+	layer := &countingLayer{Layer: source}
+
+	img, err := mutate.AppendLayers(empty.Image, layer)
+	if err != nil {
+		t.Fatalf("mutate.AppendLayers() error = %v", err)
+	}
+
+	recompressed, err := recompressImage(img, CompressionZstd)
+	if err != nil {
+		t.Fatalf("recompressImage() error = %v", err)
+	}
+
+	layers, err := recompressed.Layers()
+	if err != nil {
+		t.Fatalf("Layers() error = %v", err)
+	}
+
+	// Once the digest is computed, reading the content, like a push (even retried), doesn't
+	// recompress the layer.
+	for _, l := range layers {
+		_, err = l.Digest()
+		if err != nil {
+			t.Fatalf("Digest() error = %v", err)
+		}
+
+		opens := layer.opens.Load()
+
+		for range 2 {
+			rc, err := l.Compressed()
+			if err != nil {
+				t.Fatalf("Compressed() error = %v", err)
+			}
+
+			_, err = io.Copy(io.Discard, rc)
+			if err != nil {
+				t.Fatalf("io.Copy() error = %v", err)
+			}
+
+			rc.Close()
+		}
+
+		if got := layer.opens.Load(); got != opens {
+			t.Errorf("reading the recompressed layer read the source layer %d more times, want none", got-opens)
+		}
+	}
+}
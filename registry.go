@@ -1,32 +1,116 @@
 package registry
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
-	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"golang.org/x/sync/errgroup"
 )
 
-const EnvGcrJSONKeyPath = "GCR_JSON_KEY_PATH"
+const (
+	EnvGcrJSONKeyPath   = "GCR_JSON_KEY_PATH"
+	EnvDockerAuthConfig = "DOCKER_AUTH_CONFIG"
+)
 
 // Registry is a struct to work with authenticated container registries.
 type Registry struct {
-	URL           string
-	authenticator authn.Authenticator
+	URL string
+
+	ctx context.Context //nolint:containedctx
+
+	mu                 sync.RWMutex
+	authenticator      authn.Authenticator
+	hostAuthenticators map[string]authn.Authenticator
+	keychain           authn.Keychain
+	puller             *remote.Puller
+	bearerToken        string
+	requireAuth        bool
+
+	rateLimit rateLimit
+
+	clock            Clock
+	headers          http.Header
+	acceptMediaTypes []types.MediaType
+
+	noLibraryNamespace  bool
+	noImplicitDockerHub bool
+	repositoryPrefix    string
+	rewrites            []RewriteRule
+	apiVersion          string
+	defaultPlatform     *v1.Platform
+	platformFallback    *v1.Platform
+	schema1Conversion   bool
+	nameOptions         []name.Option
+
+	maxResponseBodySize int64
+	blobRetryAttempts   int
+	operationDeadline   time.Duration
+	backoffJitter       float64
+	offlineLayout       string
+	requireDigest       bool
+	postWriteVerify     bool
+	pins                *tagPins
+
+	refLogger *slog.Logger
+	eventSink EventSink
+
+	httpClient     *http.Client
+	readTransport  http.RoundTripper
+	writeTransport http.RoundTripper
+}
+
+// New creates a new Registry instance, configured with the given options.
+func New(url string, opts ...Option) (*Registry, error) {
+	return NewWithContext(context.Background(), url, opts...)
 }
 
-// New creates a new Registry instance.
-func New(url string) (*Registry, error) {
-	r := Registry{URL: url}
+// NewWithContext creates a new Registry instance like New, using ctx for the resolution of the
+// credentials only, so it can't block past the ctx deadline. The requests sent to the registry
+// later on use the context given with WithContext, if any, and are not bound by ctx.
+func NewWithContext(ctx context.Context, url string, opts ...Option) (*Registry, error) {
+	r := Registry{
+		URL:           url,
+		ctx:           context.Background(),
+		clock:         realClock{},
+		backoffJitter: defaultBackoffJitter,
+	}
+
+	for _, opt := range opts {
+		opt(&r)
+	}
+
+	if r.keychain == nil {
+		r.keychain = authn.DefaultKeychain
+	}
+
+	if r.apiVersion != "" && r.apiVersion != apiVersionV2 {
+		return nil, fmt.Errorf("failed to pin api version %s: %w", r.apiVersion, ErrUnsupportedAPIVersion)
+	}
+
+	if r.noImplicitDockerHub {
+		r.nameOptions = append(r.nameOptions, name.WithDefaultRegistry(r.RegistryStr()))
+	}
+
+	if r.repositoryPrefix != "" {
+		err := r.checkRepositoryPrefix()
+		if err != nil {
+			return nil, fmt.Errorf("failed to set repository prefix %s: %w", r.repositoryPrefix, err)
+		}
+	}
 
-	err := r.initAuthenticator()
+	err := r.initAuthenticator(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to init authenticator: %w", err)
 	}
@@ -41,35 +125,97 @@ func (r *Registry) String() string {
 
 // RegistryStr is the Implementation of "github.com/google/go-containerregistry/pkg/authn/Resource".
 func (r *Registry) RegistryStr() string {
-	return strings.Split(r.URL, "/")[0]
+	reg, err := r.registry()
+	if err != nil {
+		return strings.Split(r.URL, "/")[0]
+	}
+
+	return reg.RegistryStr()
+}
+
+// LastRateLimit returns the pull quota (like the Docker Hub one) reported by the RateLimit-Limit
+// and RateLimit-Remaining headers of the last manifest response carrying them. ok is false until
+// the registry reports one.
+func (r *Registry) LastRateLimit() (int, int, bool) {
+	r.rateLimit.mu.Lock()
+	defer r.rateLimit.mu.Unlock()
+
+	return r.rateLimit.limit, r.rateLimit.remaining, r.rateLimit.ok
 }
 
 // Head is a wrapper to the remote.Head method.
-func (r *Registry) Head(imageRef string) (*v1.Descriptor, error) {
-	ref, err := name.ParseReference(imageRef)
+func (r *Registry) Head(imageRef string, opts ...CallOption) (*v1.Descriptor, error) {
+	ref, err := r.parseReference(imageRef)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse image reference %s: %w", imageRef, err)
 	}
 
-	head, err := remote.Head(ref, remote.WithAuth(r.authenticator))
+	var head *v1.Descriptor
+
+	err = r.withAuthRefresh(func() error {
+		if r.offlineLayout != "" {
+			_, desc, err := r.layoutDescriptor(ref)
+			head = &desc
+
+			return err
+		}
+
+		head, err = remote.Head(ref, r.remoteOptions(opts...)...)
+
+		return err
+	})
 	if err != nil {
+		r.emit("Head", imageRef, v1.Hash{}, err)
+
 		return nil, fmt.Errorf("failed to get head from remote for image %s: %w", imageRef, err)
 	}
 
+	r.emit("Head", imageRef, head.Digest, nil)
+
 	return head, nil
 }
 
+// GetDescriptor is a wrapper to the remote.Get method, configured like the other calls of the
+// Registry. The returned descriptor holds the raw manifest, and can be turned into a lazily
+// fetched image or index with its Image and ImageIndex methods.
+func (r *Registry) GetDescriptor(imageRef string, opts ...CallOption) (*remote.Descriptor, error) {
+	ref, err := r.parseReference(imageRef)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse image reference %s: %w", imageRef, err)
+	}
+
+	var desc *remote.Descriptor
+
+	err = r.withAuthRefresh(func() error {
+		desc, err = remote.Get(ref, r.remoteOptions(opts...)...)
+
+		return err
+	})
+	if err != nil {
+		r.emit("GetDescriptor", imageRef, v1.Hash{}, err)
+
+		return nil, fmt.Errorf("failed to get manifest from remote for image %s: %w", imageRef, err)
+	}
+
+	r.emit("GetDescriptor", imageRef, desc.Digest, nil)
+
+	return desc, nil
+}
+
 // RefExists checks for the presence of the given ref on the registry.
 func (r *Registry) RefExists(imageRef string) (bool, error) {
-	ref, err := name.ParseReference(imageRef)
+	ref, err := r.parseReference(imageRef)
 	if err != nil {
 		return false, fmt.Errorf("failed to parse image reference %s: %w", imageRef, err)
 	}
 
-	_, err = remote.Head(ref, remote.WithAuth(r.authenticator))
+	err = r.withAuthRefresh(func() error {
+		_, err := remote.Head(ref, r.remoteOptions()...)
+
+		return err
+	})
 	if err != nil {
-		var tErr *transport.Error
-		if errors.As(err, &tErr) && tErr.StatusCode == http.StatusNotFound {
+		if isNotFound(err) {
 			return false, nil
 		}
 
@@ -79,60 +225,291 @@ func (r *Registry) RefExists(imageRef string) (bool, error) {
 	return true, nil
 }
 
+// ExistsAcross checks, concurrently, whether the given tag of the repository exists on each of the
+// given registries, as RefExists does, and returns whether it does keyed by registry host. The
+// registries failing to answer are missing from the map, and their errors are combined in the
+// returned error.
+func ExistsAcross(registries []*Registry, repository, tag string) (map[string]bool, error) {
+	var (
+		mu     sync.Mutex
+		exists = make(map[string]bool, len(registries))
+		errs   []error
+		group  errgroup.Group
+	)
+
+	group.SetLimit(defaultConcurrency)
+
+	for _, reg := range registries {
+		group.Go(func() error {
+			host := reg.RegistryStr()
+			found, err := reg.RefExists(fmt.Sprintf("%s/%s:%s", host, repository, tag))
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to check tag on registry %s: %w", host, err))
+
+				return nil
+			}
+
+			exists[host] = found
+
+			return nil
+		})
+	}
+
+	_ = group.Wait()
+
+	if len(errs) > 0 {
+		return exists, fmt.Errorf("failed to check tag %s of repository %s on some registries: %w",
+			tag, repository, errors.Join(errs...))
+	}
+
+	return exists, nil
+}
+
 // Inspect fetches the remote to get image information and returns it.
 // The information returned is similar to what is output by the `docker inspect` command.
-func (r *Registry) Inspect(imageRef string) (*v1.ConfigFile, error) {
-	ref, err := name.ParseReference(imageRef)
+func (r *Registry) Inspect(imageRef string, opts ...CallOption) (*v1.ConfigFile, error) {
+	ref, err := r.parseReference(imageRef)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse image reference %s: %w", imageRef, err)
 	}
 
-	img, err := remote.Image(ref, remote.WithAuth(r.authenticator))
+	var (
+		cfg    *v1.ConfigFile
+		digest v1.Hash
+	)
+
+	err = r.withAuthRefresh(func() error {
+		img, err := r.remoteImage(ref, opts...)
+		if err != nil {
+			return err
+		}
+
+		digest, err = img.Digest()
+		if err != nil {
+			return err
+		}
+
+		cfg, err = img.ConfigFile()
+
+		return err
+	})
+	r.emit("Inspect", imageRef, digest, err)
+
 	if err != nil {
 		return nil, fmt.Errorf("failed to get image details from remote for image %s: %w", imageRef, err)
 	}
 
-	cfg, err := img.ConfigFile()
+	return cfg, nil
+}
+
+// ImageID returns the image ID of the given image, as shown by docker: the digest of its config
+// blob, which differs from the manifest digest. It is read from the manifest, without downloading
+// the config nor the layers. For an index, the image matching the default platform is used.
+func (r *Registry) ImageID(imageRef string, opts ...CallOption) (string, error) {
+	ref, err := r.parseReference(imageRef)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get image details from remote for image %s: %w", imageRef, err)
+		return "", fmt.Errorf("failed to parse image reference %s: %w", imageRef, err)
 	}
 
-	return cfg, nil
+	var id v1.Hash
+
+	err = r.withAuthRefresh(func() error {
+		img, err := r.remoteImage(ref, opts...)
+		if err != nil {
+			return err
+		}
+
+		id, err = img.ConfigName()
+
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get image id from remote for image %s: %w", imageRef, err)
+	}
+
+	return id.String(), nil
 }
 
-// Retag creates a new tag for a given image ref.
-func (r *Registry) Retag(existingRef, toCreateRef string) error {
-	ref, err := name.ParseReference(existingRef)
+// Digest returns the digest of the manifest the given reference points to, as returned by Head,
+// without any platform resolution: for an index, it is the digest of the index itself, not the
+// one of its image matching the default platform.
+func (r *Registry) Digest(imageRef string, opts ...CallOption) (v1.Hash, error) {
+	head, err := r.Head(imageRef, opts...)
+	if err != nil {
+		return v1.Hash{}, err
+	}
+
+	return head.Digest, nil
+}
+
+// CheckResult is the result of CheckDigest.
+type CheckResult struct {
+	// Match is true when the reference resolves to the expected digest.
+	Match bool
+	// Actual is the digest the reference resolves to.
+	Actual v1.Hash
+}
+
+// CheckDigest reports whether the given reference, typically a tag, currently resolves to the
+// expected digest, normalized with NormalizeDigest, with a single manifest HEAD request (see Digest).
+func (r *Registry) CheckDigest(imageRef, expected string, opts ...CallOption) (CheckResult, error) {
+	expected, err := NormalizeDigest(expected)
+	if err != nil {
+		return CheckResult{}, err
+	}
+
+	actual, err := r.Digest(imageRef, opts...)
+	if err != nil {
+		return CheckResult{}, err
+	}
+
+	return CheckResult{Match: actual.String() == expected, Actual: actual}, nil
+}
+
+// ContentKey returns a key identifying the exact content of the given image, suitable for caches:
+// the digest of its manifest, as "algorithm:hex", whatever tag resolves to it. For an index, it is
+// the digest of the index itself (see Digest), so the key covers all its platforms.
+func (r *Registry) ContentKey(imageRef string, opts ...CallOption) (string, error) {
+	digest, err := r.Digest(imageRef, opts...)
+	if err != nil {
+		return "", err
+	}
+
+	return digest.String(), nil
+}
+
+// Image fetches the given image from the remote. For an index, the image matching the default
+// platform is returned.
+func (r *Registry) Image(imageRef string, opts ...CallOption) (v1.Image, error) {
+	ref, err := r.parseReference(imageRef)
 	if err != nil {
-		return fmt.Errorf("failed to parse image reference %s: %w", existingRef, err)
+		return nil, fmt.Errorf("failed to parse image reference %s: %w", imageRef, err)
 	}
 
-	image, err := remote.Image(ref, remote.WithAuth(r.authenticator))
+	var (
+		img    v1.Image
+		digest v1.Hash
+	)
+
+	err = r.withAuthRefresh(func() error {
+		img, err = r.remoteImage(ref, opts...)
+		if err != nil {
+			return err
+		}
+
+		digest, err = img.Digest()
+
+		return err
+	})
+	r.emit("Image", imageRef, digest, err)
+
 	if err != nil {
-		return fmt.Errorf("failed to get reference from remote for image %s: %w", existingRef, err)
+		return nil, fmt.Errorf("failed to get image from remote for image %s: %w", imageRef, err)
 	}
 
-	newTag, err := name.NewTag(toCreateRef)
+	return img, nil
+}
+
+// Delete deletes the manifest of the given image ref from the registry. For a tag reference,
+// registries usually delete the manifest the tag points to, and thus all its tags.
+func (r *Registry) Delete(imageRef string, opts ...CallOption) error {
+	ref, err := r.parseDestination(imageRef)
 	if err != nil {
-		return fmt.Errorf("failed to create tag reference %s: %w", toCreateRef, err)
+		return fmt.Errorf("failed to parse image reference %s: %w", imageRef, err)
 	}
 
-	err = remote.Tag(newTag, image, remote.WithAuth(r.authenticator))
+	err = r.withAuthRefresh(func() error {
+		return remote.Delete(ref, r.remoteOptions(append(opts, withWrite())...)...)
+	})
+	r.emit("Delete", imageRef, v1.Hash{}, err)
+
 	if err != nil {
-		return fmt.Errorf("failed to create tag (from %s to %s): %w", existingRef, toCreateRef, err)
+		return fmt.Errorf("failed to delete image %s: %w", imageRef, err)
 	}
 
 	return nil
 }
 
+// Retag creates a new tag for a given image ref.
+// With WithNoOverwrite, it fails with ErrTagExists instead of moving an existing tag.
+func (r *Registry) Retag(existingRef, toCreateRef string, opts ...CallOption) error {
+	digest, err := r.retag(existingRef, toCreateRef, opts...)
+	r.emit("Retag", toCreateRef, digest, err)
+
+	return err
+}
+
+// retag implements Retag, and returns the digest of the tagged image.
+func (r *Registry) retag(existingRef, toCreateRef string, opts ...CallOption) (v1.Hash, error) {
+	ref, err := r.parseReference(existingRef)
+	if err != nil {
+		return v1.Hash{}, fmt.Errorf("failed to parse image reference %s: %w", existingRef, err)
+	}
+
+	newTag, err := r.newTag(toCreateRef)
+	if err != nil {
+		return v1.Hash{}, fmt.Errorf("failed to create tag reference %s: %w", toCreateRef, err)
+	}
+
+	var image v1.Image
+
+	err = r.withAuthRefresh(func() error {
+		image, err = remote.Image(ref, r.remoteOptions(opts...)...)
+
+		return err
+	})
+	if err != nil {
+		return v1.Hash{}, fmt.Errorf("failed to get reference from remote for image %s: %w", existingRef, err)
+	}
+
+	digest, err := image.Digest()
+	if err != nil {
+		return v1.Hash{}, fmt.Errorf("failed to compute digest for image %s: %w", existingRef, err)
+	}
+
+	if makeCallOptions(opts).noOverwrite {
+		created, err := r.checkNoOverwrite(newTag, digest, opts...)
+		if err != nil || !created {
+			return digest, err
+		}
+	}
+
+	err = r.withAuthRefresh(func() error {
+		return remote.Tag(newTag, image, r.remoteOptions(append(opts, withWrite())...)...)
+	})
+	if err != nil {
+		return digest, fmt.Errorf("failed to create tag (from %s to %s): %w", existingRef, toCreateRef, err)
+	}
+
+	return digest, r.verifyWrite(newTag, digest)
+}
+
 // initAuthenticator returns an authn.Authenticator used by the docker golang library
 // to authenticate with a docker registry
 //
 // We generate the authn.Authenticator once, otherwise the resolver will try to resolve
-// the gcloud credentials before each api call. We check for the presence of an environment
-// variable GCR_JSON_KEY_PATH. If present, we use it, otherwise, we default to the default
-// keychain mechanism.
-func (r *Registry) initAuthenticator() error {
+// the gcloud credentials before each api call. Credentials are looked up in this order:
+//   - the bearer token set with WithBearerToken, if any;
+//   - the GCR JSON key whose path is in the GCR_JSON_KEY_PATH environment variable, if set;
+//   - the credentials of the registry in the docker config JSON held by the DOCKER_AUTH_CONFIG
+//     environment variable (as injected by GitLab CI), if set and containing the registry;
+//   - the keychain set with WithKeychains, or else the default keychain mechanism, which fails
+//     with ErrAnonymousCredentials when it finds none with WithRequireAuth.
+//
+// The other registries reached by the Registry, like the source of a Copy, are authenticated
+// with the keychain only, see targetAuthenticator. The resolution with the keychain gives up once
+// ctx is done.
+func (r *Registry) initAuthenticator(ctx context.Context) error {
+	if r.bearerToken != "" {
+		r.setAuthenticator(&authn.Bearer{Token: r.bearerToken})
+
+		return nil
+	}
+
 	gcrJSONKeyPath := os.Getenv(EnvGcrJSONKeyPath)
 	if gcrJSONKeyPath != "" {
 		key, err := os.ReadFile(gcrJSONKeyPath) //nolint:gosec
@@ -140,20 +517,38 @@ func (r *Registry) initAuthenticator() error {
 			return fmt.Errorf("failed to resolve authenticator using gcr json key at %s: %w", gcrJSONKeyPath, err)
 		}
 
-		r.authenticator = &authn.Basic{
+		r.setAuthenticator(&authn.Basic{
 			Username: "_json_key",
 			Password: string(key),
-		}
+		})
 
 		return nil
 	}
 
-	var err error
+	dockerAuthConfig := os.Getenv(EnvDockerAuthConfig)
+	if dockerAuthConfig != "" {
+		auth, found, err := dockerConfigAuthenticator(r, dockerAuthConfig)
+		if err != nil {
+			return fmt.Errorf("failed to resolve authenticator using %s: %w", EnvDockerAuthConfig, err)
+		}
+
+		if found {
+			r.setAuthenticator(auth)
 
-	r.authenticator, err = authn.DefaultKeychain.Resolve(r)
+			return nil
+		}
+	}
+
+	auth, err := resolveKeychain(ctx, r.keychain, r)
 	if err != nil {
-		return fmt.Errorf("failed to resolve authenticator using default keychain: %w", err)
+		return fmt.Errorf("failed to resolve authenticator using keychain: %w", err)
+	}
+
+	if r.requireAuth && auth == authn.Anonymous {
+		return fmt.Errorf("failed to resolve credentials of %s using keychain: %w", r.RegistryStr(), ErrAnonymousCredentials)
 	}
 
+	r.setAuthenticator(auth)
+
 	return nil
 }
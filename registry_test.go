@@ -0,0 +1,82 @@
+package registry
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// startTestRegistry starts an in-memory registry, its handler wrapped by wrap if not nil, and
+// returns its host.
+func startTestRegistry(t *testing.T, wrap func(http.Handler) http.Handler) string {
+	t.Helper()
+
+	handler := ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0)))
+	if wrap != nil {
+		handler = wrap(handler)
+	}
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+func TestDigestReturnsIndexDigest(t *testing.T) {
+	t.Parallel()
+
+	host := startTestRegistry(t, nil)
+
+	idx, err := random.Index(1024, 1, 2)
+	if err != nil {
+		t.Fatalf("random.Index() error = %v", err)
+	}
+
+	ref, err := name.ParseReference(host + "/test/index:latest")
+	if err != nil {
+		t.Fatalf("name.ParseReference() error = %v", err)
+	}
+
+	err = remote.WriteIndex(ref, idx)
+	if err != nil {
+		t.Fatalf("remote.WriteIndex() error = %v", err)
+	}
+
+	want, err := idx.Digest()
+	if err != nil {
+		t.Fatalf("idx.Digest() error = %v", err)
+	}
+
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		t.Fatalf("idx.IndexManifest() error = %v", err)
+	}
+
+	r, err := New(host)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	got, err := r.Digest(ref.String())
+	if err != nil {
+		t.Fatalf("Digest() error = %v", err)
+	}
+
+	if got != want {
+		t.Errorf("Digest() = %s, want the index digest %s", got, want)
+	}
+
+	for _, child := range manifest.Manifests {
+		if got == child.Digest {
+			t.Errorf("Digest() = %s, the digest of a child of the index", got)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package registry
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// CopyReport summarizes how the content pushed by a Copy differs from its source, as filled by
+// WithReport.
+type CopyReport struct {
+	// SourceDigest is the digest of the copied image or index.
+	SourceDigest v1.Hash
+	// Digest is the digest of the pushed image or index.
+	Digest v1.Hash
+	// Images holds the changes of each copied image, in the order of the index for an index.
+	Images []ImageReport
+}
+
+// ImageReport describes how an image pushed by a Copy differs from its source.
+type ImageReport struct {
+	// SourceDigest is the digest of the source image.
+	SourceDigest v1.Hash
+	// Digest is the digest of the pushed image, equal to SourceDigest when it is unchanged.
+	Digest v1.Hash
+	// LayersAdded are the layers of the pushed image which are not in the source, like the
+	// recompressed ones.
+	LayersAdded []v1.Descriptor
+	// LayersRemoved are the layers of the source which are not in the pushed image, like the
+	// filtered or recompressed ones.
+	LayersRemoved []v1.Descriptor
+	// MediaTypes maps each converted media type of the manifest, config or layers to the one it
+	// was converted to.
+	MediaTypes map[types.MediaType]types.MediaType
+	// AnnotationsChanged lists, sorted, the manifest annotations added, removed or modified.
+	AnnotationsChanged []string
+}
+
+// WithReport makes Copy fill report with the changes made to the copied content by the other copy
+// options, like WithRecompress, WithLayerFilter or WithConvertToOCI, to document how the pushed
+// content differs from its source.
+func WithReport(report *CopyReport) CopyOption {
+	return func(co *copyOptions) {
+		co.report = report
+	}
+}
+
+// reportImage adds to the report of the copy options, if any, the changes between the source
+// image and the transformed one.
+func (co copyOptions) reportImage(src, transformed v1.Image) error {
+	if co.report == nil {
+		return nil
+	}
+
+	report, err := imageReport(src, transformed)
+	if err != nil {
+		return fmt.Errorf("failed to report image changes: %w", err)
+	}
+
+	co.report.Images = append(co.report.Images, *report)
+
+	return nil
+}
+
+// imageReport returns the changes between the source image and the transformed one.
+func imageReport(src, transformed v1.Image) (*ImageReport, error) {
+	srcManifest, err := src.Manifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get source manifest: %w", err)
+	}
+
+	manifest, err := transformed.Manifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get manifest: %w", err)
+	}
+
+	var report ImageReport
+
+	report.SourceDigest, err = src.Digest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute source digest: %w", err)
+	}
+
+	report.Digest, err = transformed.Digest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute digest: %w", err)
+	}
+
+	report.MediaTypes = make(map[types.MediaType]types.MediaType)
+	convertedMediaType := func(from, to types.MediaType) {
+		if from != to {
+			report.MediaTypes[from] = to
+		}
+	}
+
+	convertedMediaType(srcManifest.MediaType, manifest.MediaType)
+	convertedMediaType(srcManifest.Config.MediaType, manifest.Config.MediaType)
+
+	for _, layer := range srcManifest.Layers {
+		i := slices.IndexFunc(manifest.Layers, func(desc v1.Descriptor) bool { return desc.Digest == layer.Digest })
+		if i < 0 {
+			report.LayersRemoved = append(report.LayersRemoved, layer)
+
+			continue
+		}
+
+		convertedMediaType(layer.MediaType, manifest.Layers[i].MediaType)
+	}
+
+	for _, layer := range manifest.Layers {
+		if !slices.ContainsFunc(srcManifest.Layers, func(desc v1.Descriptor) bool { return desc.Digest == layer.Digest }) {
+			report.LayersAdded = append(report.LayersAdded, layer)
+		}
+	}
+
+	keys := slices.Concat(
+		slices.Collect(maps.Keys(srcManifest.Annotations)), slices.Collect(maps.Keys(manifest.Annotations)),
+	)
+	slices.Sort(keys)
+
+	for _, key := range slices.Compact(keys) {
+		srcValue, inSrc := srcManifest.Annotations[key]
+		value, inTransformed := manifest.Annotations[key]
+
+		if inSrc != inTransformed || srcValue != value {
+			report.AnnotationsChanged = append(report.AnnotationsChanged, key)
+		}
+	}
+
+	return &report, nil
+}
@@ -0,0 +1,186 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"golang.org/x/sync/errgroup"
+)
+
+// ErrTagExists is returned by Retag with WithNoOverwrite when the tag already points to another digest.
+var ErrTagExists = errors.New("tag already exists")
+
+// RetagBatch creates the tags of the given source→destination mapping, running at most concurrency
+// retags at once (or a default amount if concurrency isn't positive).
+//
+// Sources are fetched only once, even when written differently (e.g. "nginx@sha256:..." and
+// "docker.io/library/nginx@sha256:..."). The returned map holds the error of each failed entry,
+// keyed by source, and the returned error combines all of them.
+func (r *Registry) RetagBatch(mapping map[string]string, concurrency int) (map[string]error, error) {
+	if concurrency <= 0 {
+		concurrency = defaultConcurrency
+	}
+
+	var (
+		mu      sync.Mutex
+		fetches = make(map[string]func() (v1.Image, error))
+		failed  = make(map[string]error)
+		group   errgroup.Group
+	)
+
+	group.SetLimit(concurrency)
+
+	for existingRef, toCreateRef := range mapping {
+		ref, err := r.parseReference(existingRef)
+		if err != nil {
+			mu.Lock()
+			failed[existingRef] = fmt.Errorf("failed to parse image reference %s: %w", existingRef, err)
+			mu.Unlock()
+
+			continue
+		}
+
+		fetch, ok := fetches[ref.Name()]
+		if !ok {
+			fetch = sync.OnceValues(func() (v1.Image, error) {
+				var image v1.Image
+
+				err := r.withAuthRefresh(func() error {
+					var err error
+
+					image, err = remote.Image(ref, r.remoteOptions()...)
+
+					return err
+				})
+
+				return image, err
+			})
+			fetches[ref.Name()] = fetch
+		}
+
+		group.Go(func() error {
+			err := r.retagFetched(existingRef, toCreateRef, fetch)
+			if err != nil {
+				mu.Lock()
+				defer mu.Unlock()
+
+				failed[existingRef] = err
+			}
+
+			return nil
+		})
+	}
+
+	_ = group.Wait()
+
+	if len(failed) > 0 {
+		errs := make([]error, 0, len(failed))
+		for _, err := range failed {
+			errs = append(errs, err)
+		}
+
+		return failed, fmt.Errorf("failed to retag %d of %d images: %w", len(failed), len(mapping), errors.Join(errs...))
+	}
+
+	return failed, nil
+}
+
+// retagFetched creates the tag toCreateRef for the image returned by fetch.
+func (r *Registry) retagFetched(existingRef, toCreateRef string, fetch func() (v1.Image, error)) error {
+	newTag, err := r.newTag(toCreateRef)
+	if err != nil {
+		return fmt.Errorf("failed to create tag reference %s: %w", toCreateRef, err)
+	}
+
+	image, err := fetch()
+	if err != nil {
+		return fmt.Errorf("failed to get reference from remote for image %s: %w", existingRef, err)
+	}
+
+	err = r.withAuthRefresh(func() error {
+		return remote.Tag(newTag, image, r.remoteOptions(withWrite())...)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create tag (from %s to %s): %w", existingRef, toCreateRef, err)
+	}
+
+	if r.postWriteVerify {
+		digest, err := image.Digest()
+		if err != nil {
+			return fmt.Errorf("failed to compute digest for image %s: %w", existingRef, err)
+		}
+
+		return r.verifyWrite(newTag, digest)
+	}
+
+	return nil
+}
+
+// PointTag points the given tag reference (like "eu.gcr.io/project/app:stable") to the given digest
+// of the same repository, by putting the manifest of the digest under the tag: unlike Retag, only
+// the manifest is fetched, neither the config nor the layers.
+func (r *Registry) PointTag(tag, digest string) error {
+	newTag, err := r.newTag(tag)
+	if err != nil {
+		return fmt.Errorf("failed to create tag reference %s: %w", tag, err)
+	}
+
+	digest, err = NormalizeDigest(digest)
+	if err != nil {
+		return err
+	}
+
+	hash, err := v1.NewHash(digest)
+	if err != nil {
+		return fmt.Errorf("failed to parse digest %s: %w", digest, err)
+	}
+
+	err = r.withAuthRefresh(func() error {
+		desc, err := remote.Get(newTag.Context().Digest(hash.String()), r.remoteOptions()...)
+		if err != nil {
+			return err
+		}
+
+		return remote.Put(newTag, desc, r.remoteOptions(withWrite())...)
+	})
+	if err == nil {
+		err = r.verifyWrite(newTag, hash)
+	}
+
+	r.emit("PointTag", tag, hash, err)
+
+	if err != nil {
+		return fmt.Errorf("failed to point tag %s to %s: %w", tag, digest, err)
+	}
+
+	return nil
+}
+
+// checkNoOverwrite reports whether the tag must be created to point to digest: it doesn't when the
+// tag already points to it, and it fails with ErrTagExists when the tag points to another digest.
+func (r *Registry) checkNoOverwrite(tag name.Tag, digest v1.Hash, opts ...CallOption) (bool, error) {
+	var head *v1.Descriptor
+
+	err := r.withAuthRefresh(func() error {
+		var err error
+
+		head, err = remote.Head(tag, r.remoteOptions(opts...)...)
+
+		return err
+	})
+
+	switch {
+	case isNotFound(err):
+		return true, nil
+	case err != nil:
+		return false, fmt.Errorf("failed to get head from remote for image %s: %w", tag, err)
+	case head.Digest != digest:
+		return false, fmt.Errorf("failed to create tag %s pointing to %s: %w", tag, head.Digest, ErrTagExists)
+	default:
+		return false, nil
+	}
+}
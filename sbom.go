@@ -0,0 +1,115 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+const (
+	// SBOMFormatSPDX is the artifact type of SPDX JSON SBOMs.
+	SBOMFormatSPDX = "application/spdx+json"
+	// SBOMFormatCycloneDX is the artifact type of CycloneDX JSON SBOMs.
+	SBOMFormatCycloneDX = "application/vnd.cyclonedx+json"
+
+	// annotationCreated is the OCI annotation holding the creation date of an artifact.
+	annotationCreated = "org.opencontainers.image.created"
+)
+
+var (
+	// ErrSBOMNotFound is returned when no SBOM is attached to an image.
+	ErrSBOMNotFound = errors.New("no sbom attached to image")
+
+	errArtifactNoBlob = errors.New("artifact has no blob")
+)
+
+// SBOM fetches the SBOM attached to the given image ref through the referrers API, and returns
+// its content along with its format (SBOMFormatSPDX or SBOMFormatCycloneDX).
+//
+// Formats can be given to restrict which SBOMs are accepted. When several SBOMs are attached,
+// the most recent one (according to its "org.opencontainers.image.created" annotation) is returned.
+func (r *Registry) SBOM(imageRef string, formats ...string) ([]byte, string, error) {
+	if len(formats) == 0 {
+		formats = []string{SBOMFormatSPDX, SBOMFormatCycloneDX}
+	}
+
+	ref, err := r.parseReference(imageRef)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to parse image reference %s: %w", imageRef, err)
+	}
+
+	var head *v1.Descriptor
+
+	err = r.withAuthRefresh(func() error {
+		head, err = remote.Head(ref, r.remoteOptions()...)
+
+		return err
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get head from remote for image %s: %w", imageRef, err)
+	}
+
+	var manifest *v1.IndexManifest
+
+	err = r.withAuthRefresh(func() error {
+		index, err := remote.Referrers(ref.Context().Digest(head.Digest.String()), r.remoteOptions()...)
+		if err != nil {
+			return err
+		}
+
+		manifest, err = index.IndexManifest()
+
+		return err
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get referrers from remote for image %s: %w", imageRef, err)
+	}
+
+	var sbom *v1.Descriptor
+
+	for i, desc := range manifest.Manifests {
+		if !slices.Contains(formats, desc.ArtifactType) {
+			continue
+		}
+
+		// RFC 3339 dates are compared lexicographically, missing dates sort first.
+		if sbom == nil || desc.Annotations[annotationCreated] >= sbom.Annotations[annotationCreated] {
+			sbom = &manifest.Manifests[i]
+		}
+	}
+
+	if sbom == nil {
+		return nil, "", fmt.Errorf("failed to find sbom for image %s: %w", imageRef, ErrSBOMNotFound)
+	}
+
+	var data []byte
+
+	err = r.withAuthRefresh(func() error {
+		data, err = r.readArtifactBlob(ref.Context().Digest(sbom.Digest.String()))
+
+		return err
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to download sbom for image %s: %w", imageRef, err)
+	}
+
+	return data, sbom.ArtifactType, nil
+}
+
+// readArtifactBlob returns the content of the first blob attached to the given artifact manifest.
+func (r *Registry) readArtifactBlob(ref name.Digest) ([]byte, error) {
+	blobs, err := r.readArtifactBlobs(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(blobs) == 0 {
+		return nil, fmt.Errorf("failed to read artifact %s: %w", ref, errArtifactNoBlob)
+	}
+
+	return blobs[0].Data, nil
+}
@@ -0,0 +1,67 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// ErrNoSemverTag is returned by LatestSemver when no tag of the repository satisfies the constraint.
+var ErrNoSemverTag = errors.New("no semver tag found")
+
+// LatestSemver returns the highest tag of the given repository that is a strict semantic version
+// like "1.2.3" (optionally prefixed with "v") satisfying the given constraint, such as ">=1.2, <2".
+// Partial versions like "1.2" and other tags like "latest" or a commit hash are ignored.
+//
+// An empty constraint accepts any version. Pre-release versions are excluded unless the
+// constraint explicitly includes one, such as ">=1.2.0-rc.1".
+func (r *Registry) LatestSemver(repository, constraint string) (string, error) {
+	repo, err := r.newRepository(repository)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse repository %s: %w", repository, err)
+	}
+
+	var constraints *semver.Constraints
+
+	if constraint != "" {
+		constraints, err = semver.NewConstraint(constraint)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse semver constraint %q: %w", constraint, err)
+		}
+	}
+
+	tags, err := r.listTags(repo)
+	if err != nil {
+		return "", fmt.Errorf("failed to list tags from remote for repository %s: %w", repository, err)
+	}
+
+	var (
+		latest    string
+		latestVer *semver.Version
+	)
+
+	for _, tag := range tags {
+		version, err := semver.StrictNewVersion(strings.TrimPrefix(tag, "v"))
+		if err != nil {
+			continue
+		}
+
+		if (constraints != nil && !constraints.Check(version)) ||
+			(constraints == nil && version.Prerelease() != "") {
+			continue
+		}
+
+		if latestVer == nil || version.GreaterThan(latestVer) {
+			latest, latestVer = tag, version
+		}
+	}
+
+	if latestVer == nil {
+		return "", fmt.Errorf("failed to find latest tag of repository %s matching %q: %w",
+			repository, constraint, ErrNoSemverTag)
+	}
+
+	return latest, nil
+}
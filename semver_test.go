@@ -0,0 +1,65 @@
+package registry
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+func TestLatestSemver(t *testing.T) {
+	t.Parallel()
+
+	host := startTestRegistry(t, nil)
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() error = %v", err)
+	}
+
+	for _, tag := range []string{"1.2.0", "v1.10.0", "1.3", "1.11", "2.0.0-rc.1", "latest", "20240101"} {
+		ref, err := name.ParseReference(host + "/test/app:" + tag)
+		if err != nil {
+			t.Fatalf("name.ParseReference() error = %v", err)
+		}
+
+		err = remote.Write(ref, img)
+		if err != nil {
+			t.Fatalf("remote.Write() error = %v", err)
+		}
+	}
+
+	r, err := New(host)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tests := []struct {
+		constraint string
+		want       string
+		wantErr    error
+	}{
+		{constraint: "", want: "v1.10.0"},
+		{constraint: "<1.5", want: "1.2.0"},
+		{constraint: "~1.10", want: "v1.10.0"},
+		{constraint: ">=2.0.0-rc.1", want: "2.0.0-rc.1"},
+		{constraint: ">=3", wantErr: ErrNoSemverTag},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.constraint, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := r.LatestSemver(host+"/test/app", tt.constraint)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("LatestSemver() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("LatestSemver() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,294 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"golang.org/x/sync/errgroup"
+)
+
+// ErrInvalidBandwidth is returned by EstimatedPullDuration when the bandwidth isn't positive.
+var ErrInvalidBandwidth = errors.New("bandwidth must be positive")
+
+// Size returns the compressed size of the given image, which is the sum of the sizes of its layers
+// as listed in its manifest. For an index, the image matching the default platform is used when
+// the Registry has one, otherwise the sizes of all its images are summed.
+func (r *Registry) Size(imageRef string) (int64, error) {
+	ref, err := r.parseReference(imageRef)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse image reference %s: %w", imageRef, err)
+	}
+
+	var size int64
+
+	err = r.withAuthRefresh(func() error {
+		desc, err := remote.Get(ref, r.imageOptions()...)
+		if err != nil {
+			return err
+		}
+
+		if !desc.MediaType.IsIndex() || r.defaultPlatform != nil {
+			img, err := r.descriptorImage(desc)
+			if err != nil {
+				return err
+			}
+
+			size, err = imageSize(img)
+
+			return err
+		}
+
+		idx, err := desc.ImageIndex()
+		if err != nil {
+			return err
+		}
+
+		size, err = indexSize(idx)
+
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get size from remote for image %s: %w", imageRef, err)
+	}
+
+	return size, nil
+}
+
+// SizeForHost returns the compressed size of the given image as it would be pulled on the current
+// host: for an index, the size of the image matching the OS and architecture of the running
+// program (runtime.GOOS and runtime.GOARCH), failing with ErrPlatformNotFound if there is none.
+func (r *Registry) SizeForHost(imageRef string) (int64, error) {
+	ref, err := r.parseReference(imageRef)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse image reference %s: %w", imageRef, err)
+	}
+
+	host := v1.Platform{OS: runtime.GOOS, Architecture: runtime.GOARCH}
+
+	var size int64
+
+	err = r.withAuthRefresh(func() error {
+		desc, err := remote.Get(ref, r.remoteOptions()...)
+		if err != nil {
+			return err
+		}
+
+		img, err := hostImage(desc, host)
+		if err != nil {
+			return err
+		}
+
+		size, err = imageSize(img)
+
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get size from remote for image %s: %w", imageRef, err)
+	}
+
+	return size, nil
+}
+
+// hostImage returns the image of the given descriptor or, for an index, its image matching the
+// given host platform.
+func hostImage(desc *remote.Descriptor, host v1.Platform) (v1.Image, error) {
+	if !desc.MediaType.IsIndex() {
+		return desc.Image() //nolint:wrapcheck
+	}
+
+	idx, err := desc.ImageIndex()
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	for _, child := range manifest.Manifests {
+		if child.Platform != nil && !isAttestation(child) && platformMatches(*child.Platform, host) {
+			return idx.Image(child.Digest) //nolint:wrapcheck
+		}
+	}
+
+	return nil, fmt.Errorf("failed to find image for platform %s: %w", host.String(), ErrPlatformNotFound)
+}
+
+// EstimatedPullDuration returns the time needed to download the layers of the given image at the
+// given bandwidth, in bytes per second. For an index, the size of the image that would be pulled
+// is used: the one matching the default platform (linux/amd64 unless set with WithDefaultPlatform).
+func (r *Registry) EstimatedPullDuration(imageRef string, bytesPerSec int64) (time.Duration, error) {
+	if bytesPerSec <= 0 {
+		return 0, fmt.Errorf("failed to estimate pull duration at %d bytes/s: %w", bytesPerSec, ErrInvalidBandwidth)
+	}
+
+	img, err := r.Image(imageRef)
+	if err != nil {
+		return 0, err
+	}
+
+	size, err := imageSize(img)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get size from remote for image %s: %w", imageRef, err)
+	}
+
+	return time.Duration(float64(size) / float64(bytesPerSec) * float64(time.Second)), nil
+}
+
+// UncompressedSize returns the size the layers of the given image occupy once extracted.
+// For an index, the image matching the default platform (linux/amd64 unless set with
+// WithDefaultPlatform) is used.
+//
+// Uncompressed sizes are not stored in the manifest, so every layer is downloaded and
+// decompressed on the fly to be measured: this is much more expensive than Size.
+func (r *Registry) UncompressedSize(imageRef string) (int64, error) {
+	ref, err := r.parseReference(imageRef)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse image reference %s: %w", imageRef, err)
+	}
+
+	var size int64
+
+	err = r.withAuthRefresh(func() error {
+		img, err := r.remoteImage(ref, withLayerStreaming())
+		if err != nil {
+			return err
+		}
+
+		layers, err := img.Layers()
+		if err != nil {
+			return err
+		}
+
+		size = 0
+
+		for _, layer := range layers {
+			n, err := uncompressedLayerSize(layer)
+			if err != nil {
+				return err
+			}
+
+			size += n
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get uncompressed size from remote for image %s: %w", imageRef, err)
+	}
+
+	return size, nil
+}
+
+// imageSize returns the sum of the compressed sizes of the layers of the given image.
+func imageSize(img v1.Image) (int64, error) {
+	manifest, err := img.Manifest()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get manifest: %w", err)
+	}
+
+	var size int64
+	for _, layer := range manifest.Layers {
+		size += layer.Size
+	}
+
+	return size, nil
+}
+
+// indexSize returns the sum of the compressed sizes of all the images of the given index.
+func indexSize(idx v1.ImageIndex) (int64, error) {
+	var size int64
+
+	err := walkIndexImages(idx, func(img v1.Image) error {
+		n, err := imageSize(img)
+		size += n
+
+		return err
+	})
+
+	return size, err
+}
+
+// uncompressedLayerSize streams the uncompressed content of the given layer and returns its length.
+func uncompressedLayerSize(layer v1.Layer) (int64, error) {
+	rc, err := layer.Uncompressed()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read layer: %w", err)
+	}
+	defer rc.Close()
+
+	n, err := io.Copy(io.Discard, rc)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read layer: %w", err)
+	}
+
+	return n, nil
+}
+
+// RepositoryStats returns the number of tags of the given repository, along with the number and
+// total size of the unique blobs (configs and layers) referenced by the tagged images, counting
+// blobs shared by several images once so totalBytes reflects the storage actually used.
+func (r *Registry) RepositoryStats(repository string) (int, int, int64, error) {
+	repo, err := r.newRepository(repository)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("failed to parse repository %s: %w", repository, err)
+	}
+
+	tags, err := r.listTags(repo)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("failed to list tags from remote for repository %s: %w", repository, err)
+	}
+
+	var (
+		mu    sync.Mutex
+		blobs = make(map[v1.Hash]int64)
+		group errgroup.Group
+	)
+
+	group.SetLimit(defaultConcurrency)
+
+	for _, tag := range tags {
+		group.Go(func() error {
+			var configs, layers []v1.Descriptor
+
+			err := r.withAuthRefresh(func() error {
+				var err error
+
+				configs, layers, err = r.imageBlobs(repo.Tag(tag))
+
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("failed to get blobs from remote for tag %s: %w", tag, err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			for _, blob := range append(configs, layers...) {
+				blobs[blob.Digest] = blob.Size
+			}
+
+			return nil
+		})
+	}
+
+	err = group.Wait()
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("failed to compute stats of repository %s: %w", repository, err)
+	}
+
+	var totalBytes int64
+	for _, size := range blobs {
+		totalBytes += size
+	}
+
+	return len(tags), len(blobs), totalBytes, nil
+}
@@ -0,0 +1,507 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// defaultConcurrency is the number of concurrent requests made by bulk operations.
+	defaultConcurrency = 8
+	// walkTagsPageSize is the number of tags requested per page by WalkTags.
+	walkTagsPageSize = 100
+)
+
+// StopIteration can be returned by the callback of WalkTags or WalkFiles to stop the iteration early without error.
+var StopIteration = errors.New("stop iteration") //nolint:errname,revive,staticcheck
+
+// TagDigests lists the tags of the given repository and resolves each of them to its digest.
+//
+// Tags are resolved concurrently. If some tags fail to resolve, the map of the tags that were
+// resolved is returned along with an error combining every failure.
+func (r *Registry) TagDigests(repository string) (map[string]string, error) {
+	repo, err := r.newRepository(repository)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse repository %s: %w", repository, err)
+	}
+
+	tags, err := r.listTags(repo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags from remote for repository %s: %w", repository, err)
+	}
+
+	var (
+		mu      sync.Mutex
+		digests = make(map[string]string, len(tags))
+		errs    []error
+		group   errgroup.Group
+	)
+
+	group.SetLimit(defaultConcurrency)
+
+	for _, tag := range tags {
+		group.Go(func() error {
+			var head *v1.Descriptor
+
+			err := r.withAuthRefresh(func() error {
+				var err error
+
+				head, err = remote.Head(repo.Tag(tag), r.remoteOptions()...)
+
+				return err
+			})
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to get head from remote for tag %s: %w", tag, err))
+
+				return nil
+			}
+
+			digests[tag] = head.Digest.String()
+
+			return nil
+		})
+	}
+
+	_ = group.Wait()
+
+	if len(errs) > 0 {
+		return digests, fmt.Errorf("failed to resolve some tags of repository %s: %w", repository, errors.Join(errs...))
+	}
+
+	return digests, nil
+}
+
+// TagsForDigest returns the tags of the given repository currently pointing to the given digest,
+// sorted. Every tag is resolved, concurrently, like with TagDigests.
+func (r *Registry) TagsForDigest(repository, digest string) ([]string, error) {
+	digest, err := NormalizeDigest(digest)
+	if err != nil {
+		return nil, err
+	}
+
+	tagDigests, err := r.TagDigests(repository)
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []string
+
+	for tag, tagDigest := range tagDigests {
+		if tagDigest == digest {
+			tags = append(tags, tag)
+		}
+	}
+
+	slices.Sort(tags)
+
+	return tags, nil
+}
+
+// TagsSince returns the tags of the given repository pushed after since, sorted. The push time of
+// a tag is read from the Last-Modified header of its manifest on the registries sending it, and is
+// otherwise the creation time of the image, read from its config (the image matching the default
+// platform for an index).
+//
+// Every tag is resolved, concurrently, and on registries without Last-Modified header, this costs a
+// manifest and a config download per tag. If some tags fail to resolve, the tags pushed after since
+// among the resolved ones are returned along with an error combining every failure.
+func (r *Registry) TagsSince(repository string, since time.Time) ([]string, error) {
+	repo, err := r.newRepository(repository)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse repository %s: %w", repository, err)
+	}
+
+	tags, err := r.listTags(repo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags from remote for repository %s: %w", repository, err)
+	}
+
+	var (
+		client = r.newSharedRepositoryClient(repo, transport.PullScope)
+		mu     sync.Mutex
+		recent []string
+		errs   []error
+		group  errgroup.Group
+	)
+
+	group.SetLimit(defaultConcurrency)
+
+	for _, tag := range tags {
+		group.Go(func() error {
+			pushed, err := r.tagPushTime(client, repo.Tag(tag))
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			switch {
+			case err != nil:
+				errs = append(errs, fmt.Errorf("failed to get push time of tag %s: %w", tag, err))
+			case pushed.After(since):
+				recent = append(recent, tag)
+			}
+
+			return nil
+		})
+	}
+
+	_ = group.Wait()
+
+	slices.Sort(recent)
+
+	if len(errs) > 0 {
+		return recent, fmt.Errorf("failed to resolve some tags of repository %s: %w", repository, errors.Join(errs...))
+	}
+
+	return recent, nil
+}
+
+// tagPushTime returns the time the given tag was pushed at, as defined by TagsSince, using the
+// client of its repository.
+func (r *Registry) tagPushTime(repo *sharedRepositoryClient, tag name.Tag) (time.Time, error) {
+	var pushed time.Time
+
+	err := repo.do(func(client *http.Client) error {
+		uri := url.URL{
+			Scheme: tag.Scheme(),
+			Host:   tag.RegistryStr(),
+			Path:   fmt.Sprintf("/v2/%s/manifests/%s", tag.RepositoryStr(), tag.TagStr()),
+		}
+
+		req, err := http.NewRequestWithContext(r.ctx, http.MethodHead, uri.String(), nil)
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+
+		req.Header.Set("Accept", strings.Join([]string{
+			string(types.OCIImageIndex), string(types.OCIManifestSchema1),
+			string(types.DockerManifestList), string(types.DockerManifestSchema2),
+		}, ","))
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("failed to send request: %w", err)
+		}
+		defer resp.Body.Close()
+
+		err = transport.CheckError(resp, http.StatusOK)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		pushed, err = http.ParseTime(resp.Header.Get("Last-Modified"))
+		if err == nil {
+			return nil
+		}
+
+		img, err := r.remoteImage(tag)
+		if err != nil {
+			return err
+		}
+
+		cfg, err := img.ConfigFile()
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		pushed = cfg.Created.Time
+
+		return nil
+	})
+
+	return pushed, err
+}
+
+// AllManifestDigests returns the digests of all the manifests of the given repository, including
+// the untagged ones, on registries listing them in the "manifest" field of the tags list response
+// (like GCR and Artifact Registry).
+//
+// On other registries, untagged manifests can't be enumerated: only the digests of the tagged
+// manifests, as resolved by TagDigests, are returned.
+func (r *Registry) AllManifestDigests(repository string) ([]string, error) {
+	repo, err := r.newRepository(repository)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse repository %s: %w", repository, err)
+	}
+
+	var manifests map[string]json.RawMessage
+
+	err = r.withAuthRefresh(func() error {
+		manifests, err = r.listManifests(repo)
+
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list manifests from remote for repository %s: %w", repository, err)
+	}
+
+	if manifests != nil {
+		return slices.Sorted(maps.Keys(manifests)), nil
+	}
+
+	tagDigests, err := r.TagDigests(repository)
+	if err != nil {
+		return nil, err
+	}
+
+	digests := slices.Sorted(maps.Values(tagDigests))
+
+	return slices.Compact(digests), nil
+}
+
+// listManifests returns the manifests listed by the "manifest" extension of the tags list of the
+// given repository, merged across all its pages, or nil if the registry doesn't support it.
+func (r *Registry) listManifests(repo name.Repository) (map[string]json.RawMessage, error) {
+	client, err := r.repositoryClient(r.ctx, repo, transport.PullScope)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		manifests map[string]json.RawMessage
+		uri       = &url.URL{
+			Scheme: repo.Scheme(),
+			Host:   repo.RegistryStr(),
+			Path:   fmt.Sprintf("/v2/%s/tags/list", repo.RepositoryStr()),
+		}
+	)
+
+	for uri != nil {
+		var page *tagsList
+
+		page, uri, err = fetchTagsList(r.ctx, client, uri)
+		if err != nil {
+			return nil, err
+		}
+
+		if page.Manifests != nil {
+			if manifests == nil {
+				manifests = make(map[string]json.RawMessage, len(page.Manifests))
+			}
+
+			maps.Copy(manifests, page.Manifests)
+		}
+	}
+
+	return manifests, nil
+}
+
+// listTags returns all the tags of the given repository.
+func (r *Registry) listTags(repo name.Repository) ([]string, error) {
+	var tags []string
+
+	err := r.withAuthRefresh(func() error {
+		var err error
+
+		tags, err = remote.List(repo, r.remoteOptions()...)
+
+		return err
+	})
+
+	return tags, err
+}
+
+// ListTagsPage lists at most n tags of the given repository, starting after the tag last
+// (or from the beginning if last is empty), using the "n" and "last" parameters of the
+// distribution spec. A non-positive n lets the registry choose the page size.
+//
+// The returned next token must be given as last to fetch the following page. It is empty
+// once the last page is reached.
+func (r *Registry) ListTagsPage(repository, last string, n int) ([]string, string, error) {
+	repo, err := r.newRepository(repository)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to parse repository %s: %w", repository, err)
+	}
+
+	var (
+		tags []string
+		next string
+	)
+
+	err = r.withAuthRefresh(func() error {
+		tags, next, err = r.listTagsPage(r.ctx, repo, last, n)
+
+		return err
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list tags from remote for repository %s: %w", repository, err)
+	}
+
+	return tags, next, nil
+}
+
+// tagsList is the response of the tags list endpoint.
+type tagsList struct {
+	Tags []string `json:"tags"`
+	// Manifests is the extension of some registries (like GCR and Artifact Registry) listing every
+	// manifest of the repository, tagged or not, keyed by digest.
+	Manifests map[string]json.RawMessage `json:"manifest"`
+}
+
+// listTagsPage fetches a single page of the tags list of a repository.
+func (r *Registry) listTagsPage(ctx context.Context, repo name.Repository, last string, n int) ([]string, string, error) {
+	query := url.Values{}
+	if n > 0 {
+		query.Set("n", strconv.Itoa(n))
+	}
+
+	if last != "" {
+		query.Set("last", last)
+	}
+
+	page, next, err := r.getTagsList(ctx, repo, query)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if next == nil || len(page.Tags) == 0 {
+		return page.Tags, "", nil
+	}
+
+	return page.Tags, page.Tags[len(page.Tags)-1], nil
+}
+
+// getTagsList sends a request to the tags list endpoint of a repository, and returns its response
+// along with the URL of the following page, nil when there are no more tags to list.
+func (r *Registry) getTagsList(
+	ctx context.Context, repo name.Repository, query url.Values,
+) (*tagsList, *url.URL, error) {
+	client, err := r.repositoryClient(ctx, repo, transport.PullScope)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	uri := &url.URL{
+		Scheme:   repo.Scheme(),
+		Host:     repo.RegistryStr(),
+		Path:     fmt.Sprintf("/v2/%s/tags/list", repo.RepositoryStr()),
+		RawQuery: query.Encode(),
+	}
+
+	return fetchTagsList(ctx, client, uri)
+}
+
+// fetchTagsList fetches the page of a tags list at the given URL, and returns it along with the
+// URL of the following page, nil when there are no more tags to list.
+func fetchTagsList(ctx context.Context, client *http.Client, uri *url.URL) (*tagsList, *url.URL, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri.String(), nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = transport.CheckError(resp, http.StatusOK)
+	if err != nil {
+		return nil, nil, err //nolint:wrapcheck
+	}
+
+	var list tagsList
+
+	err = json.NewDecoder(resp.Body).Decode(&list)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode tags list: %w", err)
+	}
+
+	next, err := nextPage(uri, resp.Header.Get("Link"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &list, next, nil
+}
+
+// nextPage returns the URL of the following page given by the Link header of a paginated response
+// to the request sent to uri, like `</v2/repo/tags/list?last=b&n=2>; rel="next"`, or nil when the
+// registry sends no Link header, i.e. on the last page.
+func nextPage(uri *url.URL, link string) (*url.URL, error) {
+	if link == "" {
+		return nil, nil
+	}
+
+	target, _, _ := strings.Cut(link, ";")
+	target = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(target), "<"), ">")
+
+	next, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse link header %q: %w", link, err)
+	}
+
+	return uri.ResolveReference(next), nil
+}
+
+// WalkTags calls fn for each tag of the given repository, as the pages of the tags list are
+// received, without loading the whole list in memory.
+//
+// The iteration stops at the first error returned by fn, which is returned by WalkTags, unless
+// it is StopIteration. It also stops when the context of the Registry is canceled.
+func (r *Registry) WalkTags(repository string, fn func(tag string) error) error {
+	repo, err := r.newRepository(repository)
+	if err != nil {
+		return fmt.Errorf("failed to parse repository %s: %w", repository, err)
+	}
+
+	var last string
+
+	for {
+		err = r.ctx.Err()
+		if err != nil {
+			return fmt.Errorf("failed to list tags from remote for repository %s: %w", repository, err)
+		}
+
+		var (
+			tags []string
+			next string
+		)
+
+		err = r.withAuthRefresh(func() error {
+			tags, next, err = r.listTagsPage(r.ctx, repo, last, walkTagsPageSize)
+
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list tags from remote for repository %s: %w", repository, err)
+		}
+
+		for _, tag := range tags {
+			err = fn(tag)
+			if errors.Is(err, StopIteration) {
+				return nil
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+
+		if next == "" {
+			return nil
+		}
+
+		last = next
+	}
+}
@@ -0,0 +1,81 @@
+package registry
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+func TestTagsSince(t *testing.T) {
+	t.Parallel()
+
+	host := startTestRegistry(t, nil)
+	clock := newFakeClock()
+
+	// The in-memory registry sends no Last-Modified header, so the push time of the tags is the
+	// creation time of their image.
+	ages := map[string]time.Duration{
+		"old":    30 * 24 * time.Hour,
+		"week":   7 * 24 * time.Hour,
+		"hour":   time.Hour,
+		"latest": 0,
+	}
+
+	for tag, age := range ages {
+		img, err := random.Image(1024, 1)
+		if err != nil {
+			t.Fatalf("random.Image() error = %v", err)
+		}
+
+		img, err = mutate.CreatedAt(img, v1.Time{Time: clock.Now().Add(-age)})
+		if err != nil {
+			t.Fatalf("mutate.CreatedAt() error = %v", err)
+		}
+
+		ref, err := name.ParseReference(host + "/test/app:" + tag)
+		if err != nil {
+			t.Fatalf("name.ParseReference() error = %v", err)
+		}
+
+		err = remote.Write(ref, img)
+		if err != nil {
+			t.Fatalf("remote.Write() error = %v", err)
+		}
+	}
+
+	r, err := New(host, WithClock(clock))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		since time.Duration
+		want  []string
+	}{
+		{name: "last day", since: 24 * time.Hour, want: []string{"hour", "latest"}},
+		{name: "last two weeks", since: 14 * 24 * time.Hour, want: []string{"hour", "latest", "week"}},
+		{name: "future", since: -time.Hour, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := r.TagsSince(host+"/test/app", clock.Now().Add(-tt.since))
+			if err != nil {
+				t.Fatalf("TagsSince() error = %v", err)
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("TagsSince() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,749 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+const (
+	apiVersionV2 = "v2"
+
+	// apiVersionHeader is the header advertising the API version on the /v2/ endpoint.
+	apiVersionHeader = "Docker-Distribution-API-Version"
+	// apiVersionHeaderV2 is the value of apiVersionHeader for the registry HTTP API v2.
+	apiVersionHeaderV2 = "registry/2.0"
+
+	// defaultBackoffJitter is the default jitter of the retry backoff, as set by WithBackoffJitter.
+	defaultBackoffJitter = 0.1
+	// retryBackoffFactor is the factor the retry backoff of the remote package is multiplied by
+	// after each retry.
+	retryBackoffFactor = 3.0
+	// retryBackoffSteps is the number of retries of the remote package.
+	retryBackoffSteps = 3
+)
+
+var (
+	// ErrUnsupportedAPIVersion is returned by New when WithAPIVersion is given an unknown version.
+	ErrUnsupportedAPIVersion = errors.New("unsupported registry api version")
+	// ErrAPIVersionMismatch is returned when the registry doesn't advertise the API version pinned with WithAPIVersion.
+	ErrAPIVersionMismatch = errors.New("registry api version mismatch")
+	// ErrResponseTooLarge is returned when a response exceeds the size set with WithMaxResponseBodySize.
+	ErrResponseTooLarge = errors.New("registry response too large")
+	// ErrTagMutated is returned with WithPinTags when a tag resolves to another digest than the first time.
+	ErrTagMutated = errors.New("tag resolves to a different digest")
+	// ErrResumeUnsupported is returned with WithBlobRetry when the registry doesn't honor the Range
+	// request resuming an interrupted blob download.
+	ErrResumeUnsupported = errors.New("registry doesn't support resuming blob downloads")
+	// ErrSkipTLSVerifyUnsupported is returned with WithSkipTLSVerify when the transport set with
+	// WithReadTransport, WithWriteTransport or WithHTTPClient isn't an *http.Transport, so its TLS
+	// config can't be changed.
+	ErrSkipTLSVerifyUnsupported = errors.New("transport doesn't support skipping tls verification")
+)
+
+// headerTransport is an http.RoundTripper adding custom headers to every request.
+type headerTransport struct {
+	headers http.Header
+	inner   http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for key, values := range t.headers {
+		req.Header[key] = append([]string(nil), values...)
+	}
+
+	return t.inner.RoundTrip(req)
+}
+
+// acceptTransport is an http.RoundTripper putting the preferred media types first in the Accept
+// header of the manifest requests, followed by the other media types accepted by the request.
+type acceptTransport struct {
+	mediaTypes []types.MediaType
+	inner      http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *acceptTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if (req.Method != http.MethodGet && req.Method != http.MethodHead) || !strings.Contains(req.URL.Path, "/manifests/") {
+		return t.inner.RoundTrip(req)
+	}
+
+	accept := make([]string, 0, len(t.mediaTypes))
+	for _, mediaType := range t.mediaTypes {
+		accept = append(accept, string(mediaType))
+	}
+
+	for mediaType := range strings.SplitSeq(req.Header.Get("Accept"), ",") {
+		mediaType = strings.TrimSpace(mediaType)
+		if mediaType != "" && !slices.Contains(accept, mediaType) {
+			accept = append(accept, mediaType)
+		}
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set("Accept", strings.Join(accept, ","))
+
+	return t.inner.RoundTrip(req)
+}
+
+// apiVersionTransport is an http.RoundTripper checking the API version advertised by the /v2/ endpoint.
+type apiVersionTransport struct {
+	version string
+	inner   http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *apiVersionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.inner.RoundTrip(req)
+	if err != nil || req.URL.Path != "/v2/" {
+		return resp, err
+	}
+
+	if version := resp.Header.Get(apiVersionHeader); version != t.version {
+		resp.Body.Close()
+
+		return nil, fmt.Errorf("%s advertises api version %q instead of %q: %w",
+			req.URL.Host, version, t.version, ErrAPIVersionMismatch)
+	}
+
+	return resp, nil
+}
+
+// tagPins holds the digest each tag resolved to the first time, keyed by manifest URL.
+type tagPins struct {
+	mu      sync.Mutex
+	digests map[string]string
+}
+
+// pinTransport is an http.RoundTripper checking that the tags keep resolving to the same digest.
+type pinTransport struct {
+	pins  *tagPins
+	inner http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *pinTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.inner.RoundTrip(req)
+	if err != nil || resp.StatusCode >= http.StatusMultipleChoices {
+		return resp, err
+	}
+
+	_, reference, ok := strings.Cut(req.URL.Path, "/manifests/")
+	if !ok || strings.Contains(reference, ":") {
+		return resp, nil
+	}
+
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" && req.Method == http.MethodGet {
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read manifest %s: %w", req.URL, err)
+		}
+
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		digest = fmt.Sprintf("sha256:%x", sha256.Sum256(body))
+	}
+
+	if digest == "" {
+		return resp, nil
+	}
+
+	key := req.URL.Host + req.URL.Path
+
+	t.pins.mu.Lock()
+	defer t.pins.mu.Unlock()
+
+	pinned, ok := t.pins.digests[key]
+
+	switch {
+	case req.Method == http.MethodPut || !ok:
+		// Tags written through the Registry are expected to move.
+		t.pins.digests[key] = digest
+	case pinned != digest:
+		resp.Body.Close()
+
+		return nil, fmt.Errorf("%s resolves to %s instead of %s: %w", req.URL, digest, pinned, ErrTagMutated)
+	}
+
+	return resp, nil
+}
+
+// rateLimit holds the pull quota reported by the last manifest response carrying rate limit headers.
+type rateLimit struct {
+	mu        sync.Mutex
+	limit     int
+	remaining int
+	ok        bool
+}
+
+// rateLimitTransport is an http.RoundTripper recording the rate limit headers of the manifest responses.
+type rateLimitTransport struct {
+	rateLimit *rateLimit
+	inner     http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.inner.RoundTrip(req)
+	if err != nil || !strings.Contains(req.URL.Path, "/manifests/") {
+		return resp, err
+	}
+
+	limit, limitErr := parseRateLimitHeader(resp.Header.Get("RateLimit-Limit"))
+	remaining, remainingErr := parseRateLimitHeader(resp.Header.Get("RateLimit-Remaining"))
+
+	if limitErr == nil && remainingErr == nil {
+		t.rateLimit.mu.Lock()
+		defer t.rateLimit.mu.Unlock()
+
+		t.rateLimit.limit, t.rateLimit.remaining, t.rateLimit.ok = limit, remaining, true
+	}
+
+	return resp, nil
+}
+
+// parseRateLimitHeader parses the quota of a rate limit header, like "100;w=21600".
+func parseRateLimitHeader(value string) (int, error) {
+	quota, _, _ := strings.Cut(value, ";")
+
+	return strconv.Atoi(strings.TrimSpace(quota)) //nolint:wrapcheck
+}
+
+// limitTransport is an http.RoundTripper bounding the size of the response bodies.
+type limitTransport struct {
+	limit int64
+	inner http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *limitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.inner.RoundTrip(req)
+	if err != nil || req.Method == http.MethodHead {
+		return resp, err
+	}
+
+	if resp.ContentLength > t.limit {
+		resp.Body.Close()
+
+		return nil, fmt.Errorf("%s %s responded with %d bytes, more than %d: %w",
+			req.Method, req.URL, resp.ContentLength, t.limit, ErrResponseTooLarge)
+	}
+
+	resp.Body = &limitedBody{ReadCloser: resp.Body, remaining: t.limit}
+
+	return resp, nil
+}
+
+// limitedBody is a response body failing with ErrResponseTooLarge once its limit is exceeded.
+type limitedBody struct {
+	io.ReadCloser
+
+	remaining int64
+}
+
+// Read implements io.Reader.
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, ErrResponseTooLarge
+	}
+
+	// Read one more byte than allowed to detect bodies exceeding the limit.
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+
+	if b.remaining < 0 {
+		return n + int(b.remaining), ErrResponseTooLarge
+	}
+
+	return n, err //nolint:wrapcheck
+}
+
+// blobRetryTransport is an http.RoundTripper resuming the blob downloads interrupted by a
+// transient stream error with Range requests.
+type blobRetryTransport struct {
+	attempts int
+	inner    http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *blobRetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.inner.RoundTrip(req)
+	if err != nil || req.Method != http.MethodGet || resp.StatusCode != http.StatusOK || !isBlobRequest(req) {
+		return resp, err //nolint:wrapcheck
+	}
+
+	resp.Body = &resumableBody{ReadCloser: resp.Body, req: req, inner: t.inner, attempts: t.attempts}
+
+	return resp, nil
+}
+
+// isBlobRequest reports whether the given request fetches a blob, directly or through redirects
+// (like the ones to the storage backend of the registry).
+func isBlobRequest(req *http.Request) bool {
+	for ; req != nil; req = req.Response.Request {
+		if strings.Contains(req.URL.Path, "/blobs/") {
+			return true
+		}
+
+		if req.Response == nil {
+			return false
+		}
+	}
+
+	return false
+}
+
+// resumableBody is a blob response body which, on a transient stream error, requests the rest of
+// the blob from the last received byte and goes on reading it.
+type resumableBody struct {
+	io.ReadCloser
+
+	req      *http.Request
+	inner    http.RoundTripper
+	offset   int64
+	attempts int
+}
+
+// Read implements io.Reader.
+func (b *resumableBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.offset += int64(n)
+
+	for err != nil && b.attempts > 0 && isTransientStreamError(err) {
+		b.attempts--
+		err = b.resume()
+	}
+
+	return n, err //nolint:wrapcheck
+}
+
+// resume replaces the body with the one of a Range request starting at the last received byte.
+func (b *resumableBody) resume() error {
+	_ = b.ReadCloser.Close()
+
+	req := b.req.Clone(b.req.Context())
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", b.offset))
+
+	resp, err := b.inner.RoundTrip(req)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	if resp.StatusCode != http.StatusPartialContent ||
+		!strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", b.offset)) {
+		resp.Body.Close()
+
+		return fmt.Errorf("failed to resume %s at byte %d: %w", b.req.URL, b.offset, ErrResumeUnsupported)
+	}
+
+	b.ReadCloser = resp.Body
+
+	return nil
+}
+
+// isTransientStreamError reports whether the given error interrupting a response body, like an
+// unexpected EOF or a connection reset, is worth resuming the download.
+func isTransientStreamError(err error) bool {
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET)
+}
+
+// operationStartKey is the context key of the start time of a call to the remote package.
+type operationStartKey struct{}
+
+// operationContext returns the context of a call to the remote package, holding its start time
+// when an operation deadline is set, so that deadlineTransport bounds all its requests together.
+func (r *Registry) operationContext() context.Context {
+	if r.operationDeadline <= 0 {
+		return r.ctx
+	}
+
+	return context.WithValue(r.ctx, operationStartKey{}, r.clock.Now())
+}
+
+// boundedOperationContext returns the context of a call to the remote package like
+// operationContext, also canceled once the given ctx is done, for the methods taking their own
+// context. The returned function releases its resources.
+func (r *Registry) boundedOperationContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	opCtx, cancel := context.WithCancelCause(r.operationContext())
+	stop := context.AfterFunc(ctx, func() {
+		cancel(context.Cause(ctx))
+	})
+
+	return opCtx, func() {
+		stop()
+		cancel(context.Canceled)
+	}
+}
+
+// deadlineTransport is an http.RoundTripper failing the requests of a call to the remote package,
+// its retries included, once the given duration has elapsed since the start of the call (or since
+// the request was sent when it isn't made by the remote package), as measured by the given clock.
+type deadlineTransport struct {
+	deadline time.Duration
+	clock    Clock
+	inner    http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *deadlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start, ok := req.Context().Value(operationStartKey{}).(time.Time)
+	if !ok {
+		start = t.clock.Now()
+	}
+
+	ctx, cancel := context.WithDeadline(req.Context(), start.Add(t.deadline))
+
+	resp, err := t.inner.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+
+		return nil, err //nolint:wrapcheck
+	}
+
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+
+	return resp, nil
+}
+
+// timeoutTransport is an http.RoundTripper bounding the duration of each request, reading
+// the response body included, like http.Client.Timeout.
+type timeoutTransport struct {
+	timeout time.Duration
+	inner   http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *timeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), t.timeout)
+
+	resp, err := t.inner.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+
+		return nil, err //nolint:wrapcheck
+	}
+
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+
+	return resp, nil
+}
+
+// cancelBody is a response body canceling the context of its request once closed.
+type cancelBody struct {
+	io.ReadCloser
+
+	cancel context.CancelFunc
+}
+
+// Close implements io.Closer.
+func (b *cancelBody) Close() error {
+	defer b.cancel()
+
+	return b.ReadCloser.Close() //nolint:wrapcheck
+}
+
+// skipTLSVerifyUnsupportedTransport is an http.RoundTripper failing every request with
+// ErrSkipTLSVerifyUnsupported.
+type skipTLSVerifyUnsupportedTransport struct{}
+
+// RoundTrip implements http.RoundTripper.
+func (skipTLSVerifyUnsupportedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, fmt.Errorf("%s %s: %w", req.Method, req.URL, ErrSkipTLSVerifyUnsupported)
+}
+
+// transport returns the http.RoundTripper used to reach the registry.
+//
+// The remote package wraps it with its own auth transport, so headers added here are set
+// after authentication and can't be overridden by it.
+func (r *Registry) transport(co callOptions) http.RoundTripper {
+	if r.offlineLayout != "" {
+		return offlineTransport{}
+	}
+
+	rt := r.baseTransport(co.write)
+
+	if co.skipTLSVerify {
+		rt = insecureTransport(rt)
+	}
+
+	if r.operationDeadline > 0 {
+		rt = &deadlineTransport{deadline: r.operationDeadline, clock: r.clock, inner: rt}
+	}
+
+	if r.blobRetryAttempts > 0 {
+		rt = &blobRetryTransport{attempts: r.blobRetryAttempts, inner: rt}
+	}
+
+	if r.maxResponseBodySize > 0 && !co.streamLayers {
+		rt = &limitTransport{limit: r.maxResponseBodySize, inner: rt}
+	}
+
+	rt = &rateLimitTransport{rateLimit: &r.rateLimit, inner: rt}
+
+	if r.pins != nil {
+		rt = &pinTransport{pins: r.pins, inner: rt}
+	}
+
+	if r.apiVersion != "" {
+		rt = &apiVersionTransport{version: apiVersionHeaderV2, inner: rt}
+	}
+
+	if len(r.acceptMediaTypes) > 0 {
+		rt = &acceptTransport{mediaTypes: r.acceptMediaTypes, inner: rt}
+	}
+
+	if len(r.headers) > 0 {
+		rt = &headerTransport{headers: r.headers, inner: rt}
+	}
+
+	return rt
+}
+
+// baseTransport returns the transport of the client configured with WithHTTPClient, or else the
+// transport configured with WithReadTransport or WithWriteTransport for reads or writes, falling
+// back to the other one, then to the default transport.
+func (r *Registry) baseTransport(write bool) http.RoundTripper {
+	if r.httpClient != nil {
+		rt := r.httpClient.Transport
+		if rt == nil {
+			rt = http.DefaultTransport
+		}
+
+		if r.httpClient.Timeout > 0 {
+			rt = &timeoutTransport{timeout: r.httpClient.Timeout, inner: rt}
+		}
+
+		return rt
+	}
+
+	preferred, fallback := r.readTransport, r.writeTransport
+	if write {
+		preferred, fallback = fallback, preferred
+	}
+
+	switch {
+	case preferred != nil:
+		return preferred
+	case fallback != nil:
+		return fallback
+	default:
+		return remote.DefaultTransport
+	}
+}
+
+// remoteOptions returns the options to pass to every call to the remote package. The calls using
+// the default transport of the Registry share its puller (see sharedPuller).
+func (r *Registry) remoteOptions(opts ...CallOption) []remote.Option {
+	co := makeCallOptions(opts)
+	options := r.callRemoteOptions(co)
+
+	if co.sharesPuller() {
+		puller, err := r.sharedPuller()
+		if err == nil {
+			options = append(options, remote.Reuse(puller))
+		}
+	}
+
+	return options
+}
+
+// sharesPuller reports whether the call uses the default transport and authentication of the
+// Registry, and can therefore share its puller.
+func (co callOptions) sharesPuller() bool {
+	return !co.skipTLSVerify && !co.streamLayers && !co.write && co.auth == nil
+}
+
+// sharedPuller returns the remote.Puller shared by the calls using the default transport of the
+// Registry, created on first use: it keeps the authenticated transport of each repository, so its
+// token exchange is done once rather than on every call.
+func (r *Registry) sharedPuller() (*remote.Puller, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.puller != nil {
+		return r.puller, nil
+	}
+
+	// The context of each call is given to the calls themselves.
+	puller, err := remote.NewPuller(append(r.callRemoteOptions(callOptions{}), remote.WithContext(r.ctx))...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create puller: %w", err)
+	}
+
+	r.puller = puller
+
+	return puller, nil
+}
+
+// resetPuller forgets the shared puller, along with the transports and errors it cached.
+func (r *Registry) resetPuller() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.puller = nil
+}
+
+// callRemoteOptions returns the options of a call to the remote package with the given call options.
+func (r *Registry) callRemoteOptions(co callOptions) []remote.Option {
+	auth := remote.WithAuthFromKeychain(targetKeychain{r: r})
+	if co.auth != nil {
+		auth = remote.WithAuth(co.auth)
+	}
+
+	return []remote.Option{
+		remote.WithContext(r.operationContext()),
+		auth,
+		remote.WithTransport(r.transport(co)),
+		remote.WithRetryBackoff(remote.Backoff{
+			Duration: time.Second,
+			Factor:   retryBackoffFactor,
+			Jitter:   r.backoffJitter,
+			Steps:    retryBackoffSteps,
+		}),
+	}
+}
+
+// imageOptions returns the options to pass to the calls to the remote package resolving an index
+// to a single image, which use the default platform when one is configured.
+func (r *Registry) imageOptions(opts ...CallOption) []remote.Option {
+	options := r.remoteOptions(opts...)
+	if r.defaultPlatform != nil {
+		options = append(options, remote.WithPlatform(*r.defaultPlatform))
+	}
+
+	return options
+}
+
+// repositoryClient returns an http.Client authenticated for the given scope of the repository,
+// for the registry endpoints not covered by the remote package.
+func (r *Registry) repositoryClient(
+	ctx context.Context, repo name.Repository, scope string, opts ...CallOption,
+) (*http.Client, error) {
+	co := makeCallOptions(opts)
+
+	auth, err := r.callAuthenticator(co, repo.Registry)
+	if err != nil {
+		return nil, err
+	}
+
+	rt, err := transport.NewWithContext(
+		ctx, repo.Registry, auth, r.transport(co), []string{repo.Scope(scope)},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transport for repository %s: %w", repo, err)
+	}
+
+	return &http.Client{Transport: rt}, nil
+}
+
+// sharedRepositoryClient is the authenticated client of a repository shared by the concurrent
+// requests of a single call, created on first use so the registry is pinged and the token
+// exchanged once for all of them rather than once per request.
+type sharedRepositoryClient struct {
+	r     *Registry
+	repo  name.Repository
+	scope string
+	opts  []CallOption
+
+	mu     sync.Mutex
+	client *http.Client
+}
+
+// newSharedRepositoryClient returns a sharedRepositoryClient for the given scope of the repository.
+func (r *Registry) newSharedRepositoryClient(
+	repo name.Repository, scope string, opts ...CallOption,
+) *sharedRepositoryClient {
+	return &sharedRepositoryClient{r: r, repo: repo, scope: scope, opts: opts}
+}
+
+// do runs the given call with the shared client, within withAuthRefresh. The client is forgotten
+// when the registry rejects its credentials, so the retry authenticates again.
+func (c *sharedRepositoryClient) do(call func(client *http.Client) error) error {
+	return c.r.withAuthRefresh(func() error {
+		client, err := c.get()
+		if err != nil {
+			return err
+		}
+
+		err = call(client)
+		if isUnauthorized(err) {
+			c.forget(client)
+		}
+
+		return err
+	})
+}
+
+// get returns the shared client, creating it if needed.
+func (c *sharedRepositoryClient) get() (*http.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.client == nil {
+		client, err := c.r.repositoryClient(c.r.ctx, c.repo, c.scope, c.opts...)
+		if err != nil {
+			return nil, err
+		}
+
+		c.client = client
+	}
+
+	return c.client, nil
+}
+
+// forget drops the given client, unless it has already been replaced by a newer one.
+func (c *sharedRepositoryClient) forget(client *http.Client) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.client == client {
+		c.client = nil
+	}
+}
+
+// insecureTransport returns a copy of the given transport skipping TLS certificate verification.
+// When it isn't an *http.Transport, the returned transport fails every request with
+// ErrSkipTLSVerifyUnsupported rather than silently verifying the certificates.
+func insecureTransport(rt http.RoundTripper) http.RoundTripper {
+	if timeout, ok := rt.(*timeoutTransport); ok {
+		return &timeoutTransport{timeout: timeout.timeout, inner: insecureTransport(timeout.inner)}
+	}
+
+	t, ok := rt.(*http.Transport)
+	if !ok {
+		return skipTLSVerifyUnsupportedTransport{}
+	}
+
+	t = t.Clone()
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = &tls.Config{} //nolint:gosec
+	}
+
+	t.TLSClientConfig.InsecureSkipVerify = true //nolint:gosec
+
+	return t
+}
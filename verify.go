@@ -0,0 +1,62 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+const (
+	// postWriteVerifyAttempts is the number of times a written reference is resolved by WithPostWriteVerify.
+	postWriteVerifyAttempts = 5
+	// postWriteVerifyDelay is the delay before the second attempt, doubled after each attempt.
+	postWriteVerifyDelay = 200 * time.Millisecond
+)
+
+// ErrWriteNotVisible is returned with WithPostWriteVerify when a written reference doesn't
+// resolve to the written digest.
+var ErrWriteNotVisible = errors.New("written reference not visible")
+
+// verifyWrite checks, when enabled with WithPostWriteVerify, that the given reference resolves to
+// the given digest, retrying with an exponential backoff while the registry serves it stale or not at all.
+func (r *Registry) verifyWrite(ref name.Reference, digest v1.Hash) error {
+	if !r.postWriteVerify {
+		return nil
+	}
+
+	delay := postWriteVerifyDelay
+
+	for attempt := 1; ; attempt++ {
+		var head *v1.Descriptor
+
+		err := r.withAuthRefresh(func() error {
+			var err error
+
+			head, err = remote.Head(ref, r.remoteOptions()...)
+
+			return err
+		})
+
+		switch {
+		case err != nil && !isNotFound(err):
+			return fmt.Errorf("failed to get head from remote for image %s: %w", ref, err)
+		case err == nil && head.Digest == digest:
+			return nil
+		case attempt == postWriteVerifyAttempts:
+			return fmt.Errorf("failed to resolve %s to %s after %d attempts: %w",
+				ref, digest, attempt, ErrWriteNotVisible)
+		}
+
+		select {
+		case <-r.ctx.Done():
+			return fmt.Errorf("failed to resolve %s to %s: %w", ref, digest, r.ctx.Err())
+		case <-r.after(delay):
+		}
+
+		delay *= 2
+	}
+}
@@ -0,0 +1,104 @@
+package registry
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+func TestVerifyWriteBackoff(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		stale   int32
+		waited  []time.Duration
+		wantErr error
+	}{
+		{
+			name: "visible",
+		},
+		{
+			name:   "visible after two attempts",
+			stale:  2,
+			waited: []time.Duration{200 * time.Millisecond, 400 * time.Millisecond},
+		},
+		{
+			name:  "never visible",
+			stale: postWriteVerifyAttempts,
+			waited: []time.Duration{
+				200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, 1600 * time.Millisecond,
+			},
+			wantErr: ErrWriteNotVisible,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			// The registry answers the first stale manifest requests with a 404, like an
+			// eventually-consistent registry.
+			var stale atomic.Int32
+
+			host := startTestRegistry(t, func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+					if req.Method == http.MethodHead && strings.Contains(req.URL.Path, "/manifests/") &&
+						stale.Add(-1) >= 0 {
+						http.NotFound(w, req)
+
+						return
+					}
+
+					next.ServeHTTP(w, req)
+				})
+			})
+
+			img, err := random.Image(1024, 1)
+			if err != nil {
+				t.Fatalf("random.Image() error = %v", err)
+			}
+
+			ref, err := name.ParseReference(host + "/test/app:latest")
+			if err != nil {
+				t.Fatalf("name.ParseReference() error = %v", err)
+			}
+
+			err = remote.Write(ref, img)
+			if err != nil {
+				t.Fatalf("remote.Write() error = %v", err)
+			}
+
+			digest, err := img.Digest()
+			if err != nil {
+				t.Fatalf("img.Digest() error = %v", err)
+			}
+
+			clock := newFakeClock()
+
+			r, err := New(host, WithPostWriteVerify(), WithClock(clock))
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			stale.Store(tt.stale)
+
+			err = r.verifyWrite(ref, digest)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("verifyWrite() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if got := clock.Waited(); !slices.Equal(got, tt.waited) {
+				t.Errorf("verifyWrite() waited %v, want %v", got, tt.waited)
+			}
+		})
+	}
+}